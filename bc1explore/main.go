@@ -9,11 +9,13 @@ import (
 	"html/template"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 
 	"github.com/meeDamian/bc1toolkit/lib/common"
 	"github.com/meeDamian/bc1toolkit/lib/help"
+	"github.com/meeDamian/bc1toolkit/lib/tor"
 	"github.com/sirupsen/logrus"
 )
 
@@ -28,6 +30,12 @@ const (
 		"`~/Library/Application\\ Support/Bitcoin/bitcoin.conf` on MacOS."
 
 	name = "bc1explore"
+
+	onionNone       = "none"
+	onionEphemeral  = "ephemeral"
+	onionPersistent = "persistent"
+
+	onionKeyFile = "bc1explore-onion.key"
 )
 
 type (
@@ -115,13 +123,15 @@ var (
 		TestNet string `long:"testnet-node" short:"T" description:"REST interface of your testnet Bitcoin node" default:"http://127.0.0.1:18332"`
 		MainNet string `long:"mainnet-node" short:"M" description:"REST interface of your mainnet Bitcoin node" default:"http://127.0.0.1:8332"`
 		Port    int    `long:"port" short:"p" description:"What port should this blockchain explorer work on" default:"8080"`
+		Onion   string `long:"onion" description:"Publish explorer as a Tor onion service. 'ephemeral' - new .onion address on each run. 'persistent' - same address, key kept in toolkit's data dir. Explorer is then only listening on localhost" default:"none" choice:"none" choice:"ephemeral" choice:"persistent"`
 	}
 
+	commonOpts help.Opts
+
 	defaultPageData = PageData{
 		HtmlTitle: name,
 		Title:     name,
 		Testnet:   false,
-		BaseUrl:   baseUrl,
 	}
 
 	funcMap = template.FuncMap{
@@ -168,8 +178,9 @@ func setupTemplates() {
 }
 
 func init() {
-	help.Customize("", description, "", BinaryName, &Opts)
-	help.Parse()
+	help.Customize("", description, help.DisableTor, BinaryName, &Opts)
+	help.ShowTorControl()
+	_, commonOpts = help.Parse()
 
 	common.Logger.Name(BinaryName)
 	//common.Logger.SetLevel(logrus.InfoLevel)
@@ -179,6 +190,51 @@ func init() {
 	baseUrl = fmt.Sprintf("http://localhost:%d", Opts.Port)
 }
 
+// setBaseUrl makes page links absolute, which is only needed when served as an onion service
+func setBaseUrl(url string) {
+	baseUrl = url
+	defaultPageData.BaseUrl = url
+}
+
+// publishOnion registers explorer as an onion service.  Returned controller has to stay open for as long as the
+// service is supposed to be available.
+func publishOnion() (*tor.Controller, error) {
+	controlAddr := commonOpts.TorControl
+	if controlAddr == "" {
+		controlAddr = tor.DefaultControlPort
+	}
+
+	c, err := tor.DialControl(controlAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.Authenticate(commonOpts.TorPassword)
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	target := fmt.Sprintf("127.0.0.1:%d", Opts.Port)
+
+	var onion tor.OnionService
+	switch Opts.Onion {
+	case onionEphemeral:
+		onion, err = c.AddOnion("", 80, target)
+
+	case onionPersistent:
+		onion, err = c.AddPersistentOnion(filepath.Join(common.GetDataDir(), onionKeyFile), 80, target)
+	}
+
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	setBaseUrl(fmt.Sprintf("http://%s", onion.Hostname()))
+	return c, nil
+}
+
 func getNodeUrl(testnet bool, path string) (url string) {
 	url = Opts.MainNet
 	if testnet {
@@ -430,8 +486,21 @@ func simpleRouter(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	listenAddr := fmt.Sprintf(":%d", Opts.Port)
+
+	if Opts.Onion != onionNone {
+		c, err := publishOnion()
+		if err != nil {
+			log.WithError(err).Fatal("can't publish onion service")
+		}
+		defer c.Close()
+
+		// don't expose it on clearnet
+		listenAddr = fmt.Sprintf("127.0.0.1:%d", Opts.Port)
+	}
+
 	http.HandleFunc("/favicon.ico", http.NotFound)
 	http.HandleFunc("/", simpleRouter)
 	log.WithField("addr", baseUrl).Info("Server started")
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%d", Opts.Port), nil))
+	log.Fatal(http.ListenAndServe(listenAddr, nil))
 }
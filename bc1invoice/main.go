@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/help"
+	"github.com/meeDamian/bc1toolkit/lib/ln"
+)
+
+const (
+	BinaryName = "bc1invoice"
+
+	description = `Decodes Lightning Network invoices (BOLT 11), as well as offers, invoice requests & invoices (BOLT 12) offline. When invoices are both piped-in and provided at command line, piped ones are first.
+
+Each invoice provided, outputs its own line with its decoded content (customizable with --output=?).  Invoice signature is always verified, and payee's public key is recovered from it, if not provided explicitly.  Offers that never expire are always considered valid.
+Exit code of 0 is returned only if all invoices provided are valid and not expired.  1 is returned if any invoice is invalid, and 2 if all are valid, but at least one has expired.`
+
+	exitInvalid = 1
+	exitExpired = 2
+)
+
+type (
+	invoiceError struct {
+		Invoice string `json:"invoice"`
+		Error   string `json:"error"`
+	}
+
+	expiry struct {
+		Type      string `json:"type"`
+		ExpiresAt *int64 `json:"expires_at,omitempty"`
+		Expired   bool   `json:"expired"`
+	}
+
+	// decodedInvoice flattens expiry info into whatever was decoded
+	decodedInvoice struct {
+		decoded interface{}
+		expiry
+	}
+)
+
+func (d decodedInvoice) MarshalJSON() ([]byte, error) {
+	inner, err := json.Marshal(d.decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	outer, err := json.Marshal(d.expiry)
+	if err != nil {
+		return nil, err
+	}
+
+	if string(inner) == "{}" {
+		return outer, nil
+	}
+
+	// `{"a":1}` + `{"b":2}` => `{"a":1,"b":2}`
+	return append(append(inner[:len(inner)-1], ','), outer[1:]...), nil
+}
+
+func newDecodedInvoice(v interface{}, now time.Time) (d decodedInvoice) {
+	d.decoded = v
+
+	var expiresAt time.Time
+	hasExpiry := true
+
+	switch i := v.(type) {
+	case ln.Invoice:
+		d.Type, expiresAt = "bolt11_invoice", i.ExpiresAt()
+
+	case ln.Offer:
+		d.Type = "offer"
+		expiresAt, hasExpiry = i.ExpiresAt()
+
+	case ln.InvoiceRequest:
+		d.Type = "invoice_request"
+		expiresAt, hasExpiry = i.ExpiresAt()
+
+	case ln.Bolt12Invoice:
+		d.Type = "bolt12_invoice"
+		expiresAt, hasExpiry = i.ExpiresAt()
+	}
+
+	if hasExpiry {
+		ts := expiresAt.Unix()
+		d.ExpiresAt = &ts
+		d.Expired = !now.Before(expiresAt)
+	}
+
+	return
+}
+
+var (
+	opts struct {
+		Output string `long:"output" short:"o" description:"Choose line format: 'json' for JSON object. 'simple' for a single \"valid\", \"expired\" or \"invalid\". 'none' for no output, and only exit code" default:"json" choice:"json" choice:"simple" choice:"none"`
+	}
+
+	invoices []string
+)
+
+// NOTE: all errors returned here are quoted strings to preserve `jq` compatibility
+func init() {
+	common.Logger.Name(BinaryName)
+
+	help.Customize(
+		"[OPTIONS] invoice ...",
+		description,
+		help.DisableTor,
+		BinaryName, &opts,
+	)
+
+	// read parameters passed to a binary
+	invoices, _ = help.Parse()
+
+	// check for stuff being piped-in
+	stat, _ := os.Stdin.Stat()
+	if (stat.Mode() & os.ModeCharDevice) == 0 {
+		rawStdin, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Printf(`"%s"`+"\n", err)
+			os.Exit(1)
+		}
+
+		// process input, split into invoices and trim possible whitespaces & quotes
+		var stdinInvoices []string
+		for _, i := range strings.Split(string(rawStdin), "\n") {
+			trimmedInvoice := strings.Trim(strings.TrimSpace(i), "\"")
+			if trimmedInvoice == "" {
+				continue
+			}
+
+			stdinInvoices = append(stdinInvoices, trimmedInvoice)
+		}
+
+		// pipe data first, and then command ones seems more natural
+		invoices = append(stdinInvoices, invoices...)
+	}
+
+	if len(invoices) < 1 {
+		fmt.Println(`"At least one invoice needs to be provided"`)
+		os.Exit(1)
+	}
+}
+
+func output(v interface{}, simple string) {
+	switch opts.Output {
+	case "simple":
+		fmt.Println(simple)
+
+	case "json":
+		out, err := json.Marshal(v)
+		if err != nil {
+			common.Logger.Get().Errorf("unable to marshall response: %#v", v)
+			fmt.Println(`{"error": "unable to marshall response"}`)
+			return
+		}
+
+		fmt.Println(string(out))
+	}
+}
+
+func main() {
+	now := time.Now()
+	exitCode := 0
+
+	for _, raw := range invoices {
+		inv, err := ln.Decode(raw)
+		if err != nil {
+			common.Logger.Get().WithError(err).WithField("invoice", raw).Debugln("unable to decode invoice")
+
+			exitCode = exitInvalid
+			output(invoiceError{raw, err.Error()}, "invalid")
+			continue
+		}
+
+		decoded := newDecodedInvoice(inv, now)
+
+		if !decoded.Expired {
+			output(decoded, "valid")
+			continue
+		}
+
+		if exitCode == 0 {
+			exitCode = exitExpired
+		}
+
+		output(decoded, "expired")
+	}
+
+	os.Exit(exitCode)
+}
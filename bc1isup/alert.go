@@ -0,0 +1,117 @@
+package main
+
+import (
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/alert"
+)
+
+// alerts is set only if any of --webhook, --exec or --smtp is provided
+var alerts *alert.Dispatcher
+
+func newDispatcher() (*alert.Dispatcher, error) {
+	d := &alert.Dispatcher{Silences: make(alert.Silences)}
+
+	for _, url := range opts.Webhook {
+		d.Notifiers = append(d.Notifiers, alert.Webhook{URL: url})
+	}
+
+	for _, cmd := range opts.Exec {
+		d.Notifiers = append(d.Notifiers, alert.Exec{Command: cmd})
+	}
+
+	if opts.SMTP != "" {
+		s, err := alert.NewSMTP(opts.SMTP, opts.SMTPFrom, opts.SMTPTo)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Notifiers = append(d.Notifiers, s)
+	}
+
+	if len(d.Notifiers) == 0 {
+		return nil, nil
+	}
+
+	for _, s := range opts.Silence {
+		err := d.Silences.Parse(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return d, nil
+}
+
+// alertEvent sends an alert about a change of state of a watched target.  Targets seen up for the first time are not
+// worth alerting about.
+func alertEvent(e event) {
+	if alerts == nil || (e.Event == eventUp && e.Previous == "") {
+		return
+	}
+
+	alerts.Send(alert.Alert{
+		Time:     e.Time,
+		Address:  e.Address,
+		Event:    e.Event,
+		Up:       e.Up,
+		Previous: e.Previous,
+		Details:  e,
+	})
+}
+
+// remindWatched re-sends an alert about a watched target that's still down, every --renotify
+func remindWatched(w *watched, previous time.Time, e event) {
+	if alerts == nil || w.up || !alert.ShouldRemind(w.since, previous, e.Time, opts.Renotify) {
+		return
+	}
+
+	alerts.Send(alert.Alert{
+		Time:     e.Time,
+		Address:  e.Address,
+		Event:    eventDown,
+		Reminder: true,
+		Details:  e,
+	})
+}
+
+// alertChanges compares results of a single check of all targets against their history, and sends alerts about ones
+// that went up, down, got upgraded, or are still down for another --renotify.  W/o history, all targets that are down
+// are alerted about.
+func alertChanges(now time.Time, results map[string][]interface{}, streaks map[string]streak) {
+	if alerts == nil {
+		return
+	}
+
+	for target, found := range results {
+		up := isUp(found)
+		a := alert.Alert{Time: now, Address: target, Event: status(up), Up: up, Details: found}
+
+		s, ok := streaks[target]
+		switch {
+		case !ok || s.last.Time.IsZero():
+			if up {
+				continue
+			}
+
+		case s.last.Up != up:
+			a.Previous = status(s.last.Up)
+
+		case up:
+			previous, current := s.last.Version(), agents(found)
+			if previous == "" || previous == current {
+				continue
+			}
+
+			a.Event, a.Previous = eventVersion, previous
+
+		case alert.ShouldRemind(s.since, s.last.Time, now, opts.Renotify):
+			a.Reminder = true
+
+		default:
+			continue
+		}
+
+		alerts.Send(a)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/electrum"
+	"github.com/meeDamian/bc1toolkit/lib/rpc"
+	"github.com/meeDamian/bc1toolkit/lib/stratum"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	schemeElectrum    = "electrum"
+	schemeElectrumTLS = "electrums"
+)
+
+// electrumTarget is true for electrum:// & electrums:// targets, and ones w/o a scheme on default ports of Electrum
+// servers.  useTLS is set for electrums://, and the default TLS port.
+func electrumTarget(c connstring.ConnString) (ok, useTLS bool) {
+	switch c.Scheme {
+	case schemeElectrumTLS:
+		return true, true
+
+	case schemeElectrum, "":
+		switch c.Port {
+		case electrum.DefaultTLSPort:
+			return true, true
+
+		case electrum.DefaultPort:
+			return true, false
+		}
+
+		return c.Scheme == schemeElectrum, false
+	}
+
+	return false, false
+}
+
+// checkElectrum probes an Electrum server at c.  Unlike with nodes, network is only known after the server responds, so
+// a single probe is made, and failure is reported even if no network was requested explicitly.
+func checkElectrum(dialer proxy.Dialer, c connstring.ConnString, useTLS bool, n networks) []interface{} {
+	out, err := withRetries(c, func() (interface{}, error) {
+		return electrum.Probe(dialer, c, useTLS, opts.Timeout)
+	})
+	if err != nil {
+		return []interface{}{nodeError{c.Raw, err.Error()}}
+	}
+
+	s := out.(electrum.Server)
+	if !n.includes(s.TestNet) {
+		chain := s.Chain
+		if chain == "" {
+			chain = "unknown (genesis: " + s.GenesisHash + ")"
+		}
+
+		return []interface{}{nodeError{c.Raw, fmt.Sprintf("Electrum server is on another network: %s", chain)}}
+	}
+
+	return []interface{}{s}
+}
+
+// asNode returns x if it's a node, or a server of another kind (ex. Electrum, RPC, or a pool) described in the same terms, so that all
+// of them can be output, recorded, and compared alike
+func asNode(x interface{}) (btc.BitcoinVersion, bool) {
+	switch v := x.(type) {
+	case btc.BitcoinVersion:
+		return v, true
+
+	case electrum.Server:
+		return btc.BitcoinVersion{
+			Address:   v.Address,
+			UserAgent: v.Software,
+			LastBlock: v.LastBlock,
+			TestNet:   v.TestNet,
+			Latency:   v.Latency,
+		}, true
+
+	case rpc.Node:
+		return btc.BitcoinVersion{
+			Address:   v.Address,
+			UserAgent: v.UserAgent,
+			Version:   v.Protocol,
+			Services:  v.Services,
+			LastBlock: v.LastBlock,
+			TestNet:   v.TestNet,
+			Latency:   v.Latency,
+		}, true
+
+	case stratum.Pool:
+		return btc.BitcoinVersion{
+			Address:   v.Address,
+			LastBlock: v.LastBlock,
+			Latency:   v.Latency,
+		}, true
+	}
+
+	return btc.BitcoinVersion{}, false
+}
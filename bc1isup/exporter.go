@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/rpc"
+	"github.com/meeDamian/bc1toolkit/lib/stratum"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// all metrics exported, in the order they're output in
+	metricDefs = []struct{ name, help string }{
+		{"bc1_node_up", "Whether a Bitcoin node was found at target (1), or not (0)"},
+		{"bc1_node_handshake_seconds", "How long it took to connect to the node, and exchange version messages"},
+		{"bc1_node_protocol_version", "Protocol version reported by the node"},
+		{"bc1_node_height", "Height of the best block the node reported having, when connected"},
+		{"bc1_node_services", "Service bits advertised by the node"},
+		{"bc1_node_info", "User agent of the node, always 1"},
+		{"bc1_node_headers", "Height of the best header known to the node (RPC only)"},
+		{"bc1_node_ibd", "Whether the node is in initial block download (RPC only)"},
+		{"bc1_node_verification_progress", "Estimated fraction of the chain the node has verified (RPC only)"},
+		{"bc1_node_pruned", "Whether the node is pruned (RPC only)"},
+		{"bc1_node_peers", "Number of peers the node is connected to (RPC only)"},
+		{"bc1_node_mempool_transactions", "Number of transactions in the node's mempool (RPC only)"},
+		{"bc1_node_mempool_bytes", "Size of transactions in the node's mempool (RPC only)"},
+		{"bc1_node_warnings", "Number of warnings the node reports (RPC only)"},
+		{"bc1_pool_difficulty", "Share difficulty set by the mining pool"},
+		{"bc1_pool_version_rolling", "Whether the mining pool allows version rolling (BIP-310)"},
+		{"bc1_probe_duration_seconds", "How long probing the target took"},
+	}
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// metrics collects samples in Prometheus text format.  It's safe for concurrent use.
+type metrics struct {
+	mu      sync.Mutex
+	samples map[string][]string
+}
+
+func newMetrics() *metrics {
+	return &metrics{samples: make(map[string][]string)}
+}
+
+// add records a sample of metric name, labels are alternating names & values
+func (m *metrics) add(name string, value float64, labels ...string) {
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+
+	sample := fmt.Sprintf("%s{%s} %s", name, strings.Join(pairs, ","), strconv.FormatFloat(value, 'g', -1, 64))
+
+	m.mu.Lock()
+	m.samples[name] = append(m.samples[name], sample)
+	m.mu.Unlock()
+}
+
+func (m *metrics) WriteTo(w io.Writer) (n int64, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var b strings.Builder
+	for _, def := range metricDefs {
+		samples := m.samples[def.name]
+		if len(samples) == 0 {
+			continue
+		}
+
+		// stable output makes diffing scrapes easier
+		sort.Strings(samples)
+
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s gauge\n", def.name, def.help, def.name)
+		for _, s := range samples {
+			b.WriteString(s + "\n")
+		}
+	}
+
+	written, err := io.WriteString(w, b.String())
+	return int64(written), err
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func networkName(testNet bool) string {
+	if testNet {
+		return "testnet"
+	}
+
+	return "mainnet"
+}
+
+// networksToProbe returns which networks to probe for: ones requested explicitly, or both
+func networksToProbe(n networks) (testNets []bool) {
+	if n.MainNet || n.Auto {
+		testNets = append(testNets, false)
+	}
+
+	if n.TestNet || n.Auto {
+		testNets = append(testNets, true)
+	}
+
+	return
+}
+
+// probedPerNetwork is true for Bitcoin P2P targets, as nodes only answer on a single network.  Others report their
+// network themselves, so they're probed once.
+func probedPerNetwork(c connstring.ConnString) bool {
+	electrum, _ := electrumTarget(c)
+	return c.Scheme == "" && !electrum
+}
+
+// probe checks c for a node on networks n, records the outcome in m, and returns it.  network labels samples of the
+// target itself, and is empty for targets not probed per network.
+func probe(dialers common.Dialers, c connstring.ConnString, n networks, network string, m *metrics) []interface{} {
+	targetLabels := []string{"target", c.Raw}
+	if network != "" {
+		targetLabels = append(targetLabels, "network", network)
+	}
+
+	start := time.Now()
+	found := checkTarget(dialers, c, n)
+
+	m.add("bc1_probe_duration_seconds", time.Since(start).Seconds(), targetLabels...)
+
+	m.add("bc1_node_up", boolToFloat(isUp(found)), targetLabels...)
+
+	for _, x := range found {
+		v, ok := asNode(x)
+		if !ok {
+			common.Logger.Get().Debugf("probe of %s failed: %v", c.Raw, x)
+			continue
+		}
+
+		labels := []string{"target", c.Raw, "network", networkName(v.TestNet), "address", v.Address}
+		m.add("bc1_node_handshake_seconds", v.Latency.Seconds(), labels...)
+		m.add("bc1_node_height", float64(v.LastBlock), labels...)
+		m.add("bc1_node_info", 1, append(labels, "useragent", v.UserAgent)...)
+
+		// protocol version & services are only known for nodes
+		switch x.(type) {
+		case btc.BitcoinVersion, rpc.Node:
+			m.add("bc1_node_protocol_version", float64(v.Version), labels...)
+			m.add("bc1_node_services", float64(v.Services), labels...)
+		}
+
+		if r, ok := x.(rpc.Node); ok {
+			m.add("bc1_node_headers", float64(r.Headers), labels...)
+			m.add("bc1_node_ibd", boolToFloat(r.InitialBlockDownload), labels...)
+			m.add("bc1_node_verification_progress", r.VerificationProgress, labels...)
+			m.add("bc1_node_pruned", boolToFloat(r.Pruned), labels...)
+			m.add("bc1_node_peers", float64(r.Peers), labels...)
+			m.add("bc1_node_mempool_transactions", float64(r.MempoolSize), labels...)
+			m.add("bc1_node_mempool_bytes", float64(r.MempoolBytes), labels...)
+			m.add("bc1_node_warnings", float64(len(r.Warnings)), labels...)
+		}
+
+		if p, ok := x.(stratum.Pool); ok {
+			m.add("bc1_pool_difficulty", p.Difficulty, labels...)
+			m.add("bc1_pool_version_rolling", boolToFloat(p.VersionRolling), labels...)
+		}
+	}
+
+	return found
+}
+
+// probeAll probes all targets in parallel, up to --concurrency at once.  Bitcoin P2P targets are probed on each of
+// networks n separately, and others once.
+func probeAll(dialers common.Dialers, cs []connstring.ConnString, n networks) *metrics {
+	m := newMetrics()
+
+	type job struct {
+		target  int
+		n       networks
+		network string
+	}
+
+	var jobs []job
+	for i, c := range cs {
+		if !probedPerNetwork(c) {
+			jobs = append(jobs, job{i, n, ""})
+			continue
+		}
+
+		for _, testNet := range networksToProbe(n) {
+			jobs = append(jobs, job{i, networks{MainNet: !testNet, TestNet: testNet}, networkName(testNet)})
+		}
+	}
+
+	results := make([][]interface{}, len(jobs))
+	forEach(len(jobs), func(i int) {
+		results[i] = probe(dialers, cs[jobs[i].target], jobs[i].n, jobs[i].network, m)
+	})
+
+	// results of each target, per network
+	perNetwork := make([][][]interface{}, len(cs))
+	for i, j := range jobs {
+		perNetwork[j.target] = append(perNetwork[j.target], results[i])
+	}
+
+	recorded := make(map[string][]interface{}, len(cs))
+	for i, c := range cs {
+		recorded[c.Raw] = answered(perNetwork[i])
+	}
+
+	recordResults(recorded)
+	return m
+}
+
+// answered returns results of probes of a target on networks it answered on, or all of them if it's down on each.
+// Otherwise a node on mainnet would be recorded as down, as it doesn't answer on testnet.
+func answered(perNetwork [][]interface{}) (found []interface{}) {
+	for _, f := range perNetwork {
+		if isUp(f) {
+			found = append(found, f...)
+		}
+	}
+
+	if found != nil {
+		return
+	}
+
+	for _, f := range perNetwork {
+		found = append(found, f...)
+	}
+
+	return
+}
+
+func writeMetrics(w http.ResponseWriter, m *metrics) {
+	w.Header().Set("Content-Type", metricsContentType)
+
+	_, err := m.WriteTo(w)
+	if err != nil {
+		common.Logger.Get().WithError(err).Debugln("unable to write metrics")
+	}
+}
+
+// handler serves Prometheus metrics of all cs at /metrics, and probes of any target at /probe, in the style of
+// blackbox_exporter.  Targets are probed on each request.
+func handler(dialers common.Dialers, cs []connstring.ConnString) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeMetrics(w, probeAll(dialers, cs, requestedNetworks()))
+	})
+
+	mux.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
+		target := r.URL.Query().Get("target")
+		if target == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		c, err := connstring.Parse(target)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s is not valid: %v", connstring.Redact(target), err), http.StatusBadRequest)
+			return
+		}
+
+		if opts.Resolve {
+			err = c.Resolve(nil)
+			if err != nil {
+				common.Logger.Get().WithError(err).Debugln("unable to determine if domain is local")
+			}
+		}
+
+		n := requestedNetworks()
+		switch network := r.URL.Query().Get("network"); network {
+		case "":
+
+		case "mainnet", "testnet":
+			n = networks{MainNet: network == "mainnet", TestNet: network == "testnet"}
+
+		default:
+			http.Error(w, fmt.Sprintf("unknown network: %s (expected mainnet or testnet)", network), http.StatusBadRequest)
+			return
+		}
+
+		writeMetrics(w, probeAll(dialers, []connstring.ConnString{c}, n))
+	})
+
+	return mux
+}
+
+// serve exposes metrics at --listen, until it fails
+func serve(dialers common.Dialers, cs []connstring.ConnString) error {
+	server := &http.Server{
+		Addr:              opts.Listen,
+		Handler:           handler(dialers, cs),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	common.Logger.Get().Infof("serving metrics of %d targets at http://%s/metrics, and probes at /probe", len(cs), opts.Listen)
+
+	return server.ListenAndServe()
+}
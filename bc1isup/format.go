@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	// formatter outputs results of all checks of a single target at a time, in the order targets were provided
+	formatter interface {
+		Write(target string, found []interface{}) error
+
+		// Flush outputs anything still buffered, and is called once all targets were written
+		Flush() error
+	}
+
+	// row is a flat form of a single result, used by all formats that don't output results as-is
+	row struct {
+		Target    string `json:"target"`
+		Address   string `json:"address"`
+		Up        bool   `json:"up"`
+		UserAgent string `json:"useragent,omitempty"`
+		Protocol  int    `json:"protocol,omitempty"`
+		Services  uint64 `json:"services,omitempty"`
+		LastBlock int    `json:"lastblock,omitempty"`
+		TestNet   bool   `json:"testnet"`
+		Error     string `json:"error,omitempty"`
+	}
+
+	jsonFormatter   struct{ w io.Writer }
+	ndjsonFormatter struct{ enc *json.Encoder }
+	simpleFormatter struct{ w io.Writer }
+	noneFormatter   struct{}
+
+	csvFormatter struct {
+		w         *csv.Writer
+		hasHeader bool
+	}
+
+	tableFormatter struct {
+		w         *tabwriter.Writer
+		hasHeader bool
+	}
+
+	templateFormatter struct {
+		w io.Writer
+		t *template.Template
+	}
+)
+
+var csvHeader = []string{"target", "address", "up", "useragent", "protocol", "services", "lastblock", "testnet", "error"}
+
+// newFormatter returns formatter selected with --output, or --format
+func newFormatter(w io.Writer) (formatter, error) {
+	if opts.Format != "" {
+		t, err := template.New("format").Funcs(template.FuncMap{
+			"json": func(v interface{}) (string, error) {
+				b, err := json.Marshal(v)
+				return string(b), err
+			},
+		}).Parse(opts.Format)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid --format")
+		}
+
+		return templateFormatter{w, t}, nil
+	}
+
+	switch opts.Output {
+	case "ndjson":
+		return ndjsonFormatter{json.NewEncoder(w)}, nil
+
+	case "csv":
+		return &csvFormatter{w: csv.NewWriter(w)}, nil
+
+	case "table":
+		return &tableFormatter{w: tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)}, nil
+
+	case "simple":
+		return simpleFormatter{w}, nil
+
+	case "none":
+		return noneFormatter{}, nil
+
+	case "nagios":
+		return &nagiosFormatter{w: w}, nil
+	}
+
+	return jsonFormatter{w}, nil
+}
+
+// rows flattens all results of a target.  Target w/o any results still gets a row, so that it's not lost.
+func rows(target string, found []interface{}) (rs []row) {
+	for _, x := range found {
+		if v, ok := asNode(x); ok {
+			rs = append(rs, row{
+				Target:    target,
+				Address:   v.Address,
+				Up:        true,
+				UserAgent: v.UserAgent,
+				Protocol:  v.Version,
+				Services:  v.Services,
+				LastBlock: v.LastBlock,
+				TestNet:   v.TestNet,
+			})
+		}
+
+		if v, ok := x.(nodeError); ok {
+			rs = append(rs, row{Target: target, Address: v.Address, Error: v.Error})
+		}
+	}
+
+	if len(rs) == 0 {
+		rs = append(rs, row{Target: target, Address: target, Error: "no node found"})
+	}
+
+	return
+}
+
+func (r row) network() string {
+	if !r.Up {
+		return ""
+	}
+
+	return networkName(r.TestNet)
+}
+
+func (f jsonFormatter) Write(_ string, found []interface{}) error {
+	v, err := json.Marshal(found)
+	if err != nil {
+		// keep one line per target, even if it's broken
+		_, _ = fmt.Fprintln(f.w, `[{"error": "unable to marshall response"}]`)
+		return err
+	}
+
+	_, err = fmt.Fprintln(f.w, string(v))
+	return err
+}
+
+func (f jsonFormatter) Flush() error { return nil }
+
+func (f ndjsonFormatter) Write(target string, found []interface{}) error {
+	for _, r := range rows(target, found) {
+		err := f.enc.Encode(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f ndjsonFormatter) Flush() error { return nil }
+
+func (f simpleFormatter) Write(_ string, found []interface{}) error {
+	out := "down"
+	if isUp(found) {
+		out = "up"
+	}
+
+	_, err := fmt.Fprintln(f.w, out)
+	return err
+}
+
+func (f simpleFormatter) Flush() error { return nil }
+
+// output is irrelevant, only exit code is
+func (noneFormatter) Write(string, []interface{}) error { return nil }
+func (noneFormatter) Flush() error                      { return nil }
+
+func (f *csvFormatter) Write(target string, found []interface{}) error {
+	if !f.hasHeader {
+		f.hasHeader = true
+
+		err := f.w.Write(csvHeader)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rows(target, found) {
+		err := f.w.Write([]string{
+			r.Target,
+			r.Address,
+			strconv.FormatBool(r.Up),
+			r.UserAgent,
+			strconv.Itoa(r.Protocol),
+			strconv.FormatUint(r.Services, 10),
+			strconv.Itoa(r.LastBlock),
+			strconv.FormatBool(r.TestNet),
+			r.Error,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// flushed after each target, so that results show up as soon as they're known
+	f.w.Flush()
+	return f.w.Error()
+}
+
+func (f *csvFormatter) Flush() error {
+	f.w.Flush()
+	return f.w.Error()
+}
+
+// NOTE: columns can only be aligned once all rows are known, so nothing is output until Flush()
+func (f *tableFormatter) Write(target string, found []interface{}) error {
+	if !f.hasHeader {
+		f.hasHeader = true
+
+		_, err := fmt.Fprintln(f.w, "TARGET\tADDRESS\tSTATUS\tNETWORK\tUSERAGENT\tPROTOCOL\tHEIGHT\tSERVICES\tERROR")
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, r := range rows(target, found) {
+		status := "down"
+		if r.Up {
+			status = "up"
+		}
+
+		var protocol, height, services string
+		if r.Up {
+			height = strconv.Itoa(r.LastBlock)
+		}
+
+		// protocol version & services are only known for nodes, and not ex. Electrum servers
+		if r.Up && r.Protocol != 0 {
+			protocol, services = strconv.Itoa(r.Protocol), strconv.FormatUint(r.Services, 10)
+		}
+
+		_, err := fmt.Fprintf(f.w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			r.Target, r.Address, status, r.network(), r.UserAgent, protocol, height, services, r.Error)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *tableFormatter) Flush() error {
+	return f.w.Flush()
+}
+
+func (f templateFormatter) Write(target string, found []interface{}) error {
+	for _, r := range rows(target, found) {
+		err := f.t.Execute(f.w, r)
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(f.w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f templateFormatter) Flush() error { return nil }
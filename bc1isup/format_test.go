@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/electrum"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// formatted returns output of all targets written with --output, or --format
+func formatted(output, format string) string {
+	opts.Output, opts.Format = output, format
+	defer func() { opts.Output, opts.Format = "", "" }()
+
+	var b bytes.Buffer
+	f, err := newFormatter(&b)
+	So(err, ShouldBeNil)
+
+	for _, t := range []struct {
+		target string
+		found  []interface{}
+	}{
+		{"node.example.com", []interface{}{btc.BitcoinVersion{Address: "node.example.com", UserAgent: "/Satoshi:26.0.0/", Version: 70016, Services: 1033, LastBlock: 868123}}},
+		{"electrum://203.0.113.7", []interface{}{electrum.Server{Address: "electrum://203.0.113.7", Software: "ElectrumX 1.16.0", Protocol: "1.4", LastBlock: 2500000, TestNet: true}}},
+		{"10.0.0.5", []interface{}{nodeError{"10.0.0.5", "connection refused"}}},
+		{"empty.example.com", nil},
+	} {
+		So(f.Write(t.target, t.found), ShouldBeNil)
+	}
+
+	So(f.Flush(), ShouldBeNil)
+	return b.String()
+}
+
+func lines(l ...string) string {
+	return strings.Join(l, "\n") + "\n"
+}
+
+func TestFormatters(t *testing.T) {
+	Convey("Given a node, an Electrum server, an error, and a target w/o results", t, func() {
+		Convey("json should output results of each target as-is, one line per target", func() {
+			So(formatted("json", ""), ShouldEqual, lines(
+				`[{"address":"node.example.com","useragent":"/Satoshi:26.0.0/","protocol":70016,"services":1033,"lastblock":868123,"testnet":false}]`,
+				`[{"address":"electrum://203.0.113.7","server":"ElectrumX 1.16.0","protocol":"1.4","genesis_hash":"","lastblock":2500000,"testnet":true,"tls":false}]`,
+				`[{"address":"10.0.0.5","error":"connection refused"}]`,
+				`null`,
+			))
+		})
+
+		Convey("ndjson should output a row per result", func() {
+			So(formatted("ndjson", ""), ShouldEqual, lines(
+				`{"target":"node.example.com","address":"node.example.com","up":true,"useragent":"/Satoshi:26.0.0/","protocol":70016,"services":1033,"lastblock":868123,"testnet":false}`,
+				`{"target":"electrum://203.0.113.7","address":"electrum://203.0.113.7","up":true,"useragent":"ElectrumX 1.16.0","lastblock":2500000,"testnet":true}`,
+				`{"target":"10.0.0.5","address":"10.0.0.5","up":false,"testnet":false,"error":"connection refused"}`,
+				`{"target":"empty.example.com","address":"empty.example.com","up":false,"testnet":false,"error":"no node found"}`,
+			))
+		})
+
+		Convey("csv should output a header, and a row per result", func() {
+			So(formatted("csv", ""), ShouldEqual, lines(
+				`target,address,up,useragent,protocol,services,lastblock,testnet,error`,
+				`node.example.com,node.example.com,true,/Satoshi:26.0.0/,70016,1033,868123,false,`,
+				`electrum://203.0.113.7,electrum://203.0.113.7,true,ElectrumX 1.16.0,0,0,2500000,true,`,
+				`10.0.0.5,10.0.0.5,false,,0,0,0,false,connection refused`,
+				`empty.example.com,empty.example.com,false,,0,0,0,false,no node found`,
+			))
+		})
+
+		Convey("table should align columns, and leave ones unknown empty", func() {
+			So(formatted("table", ""), ShouldEqual, lines(
+				"TARGET                  ADDRESS                 STATUS  NETWORK  USERAGENT         PROTOCOL  HEIGHT   SERVICES  ERROR",
+				"node.example.com        node.example.com        up      mainnet  /Satoshi:26.0.0/  70016     868123   1033      ",
+				"electrum://203.0.113.7  electrum://203.0.113.7  up      testnet  ElectrumX 1.16.0            2500000            ",
+				"10.0.0.5                10.0.0.5                down                                                            connection refused",
+				"empty.example.com       empty.example.com       down                                                            no node found",
+			))
+		})
+
+		Convey("simple should output up or down per target", func() {
+			So(formatted("simple", ""), ShouldEqual, lines("up", "up", "down", "down"))
+		})
+
+		Convey("none should output nothing", func() {
+			So(formatted("none", ""), ShouldBeEmpty)
+		})
+
+		Convey("--format should execute template for each row", func() {
+			So(formatted("csv", `{{.Target}} {{.Up}} {{json .UserAgent}}`), ShouldEqual, lines(
+				`node.example.com true "/Satoshi:26.0.0/"`,
+				`electrum://203.0.113.7 true "ElectrumX 1.16.0"`,
+				`10.0.0.5 false ""`,
+				`empty.example.com false ""`,
+			))
+		})
+	})
+
+	Convey("Given an invalid --format", t, func() {
+		opts.Format = "{{.Target"
+		defer func() { opts.Format = "" }()
+
+		_, err := newFormatter(&bytes.Buffer{})
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/history"
+	"github.com/pkg/errors"
+)
+
+const (
+	commandHistory = "history"
+	commandReport  = "report"
+
+	defaultReportSince = 7 * 24 * time.Hour
+)
+
+// streak is the last recorded result of a target, and since when target is in the same state
+type streak struct {
+	last  history.Record
+	since time.Time
+}
+
+var (
+	// set if binary was called as `bc1isup history …`, or `bc1isup report …`
+	command     string
+	commandArgs []string
+
+	// how long records are kept, set up in main() from --history-retention.  Zero keeps them forever.
+	retention time.Duration
+)
+
+func historyPath() string {
+	if opts.HistoryFile != "" {
+		return opts.HistoryFile
+	}
+
+	return history.DefaultPath()
+}
+
+// toRecord converts results of all checks of a target into a history record
+func toRecord(now time.Time, found []interface{}) history.Record {
+	r := history.Record{Time: now, Up: isUp(found)}
+
+	for _, x := range found {
+		if v, ok := asNode(x); ok {
+			r.Nodes = append(r.Nodes, history.Node{
+				Address:   v.Address,
+				UserAgent: v.UserAgent,
+				Protocol:  v.Version,
+				Services:  v.Services,
+				LastBlock: v.LastBlock,
+				TestNet:   v.TestNet,
+				Latency:   v.Latency,
+			})
+		}
+
+		if v, ok := x.(nodeError); ok {
+			r.Errors = append(r.Errors, v.Error)
+		}
+	}
+
+	return r
+}
+
+// recordResults saves results of checks of all targets in history, and returns their previous streaks (see
+// history.Store.Streak()), if alerts are enabled.  As history is not essential to checks, errors are only logged.
+func recordResults(results map[string][]interface{}) (streaks map[string]streak) {
+	if opts.NoHistory || len(results) == 0 {
+		return
+	}
+
+	log := common.Logger.Get()
+
+	s, err := history.Open(historyPath())
+	if err != nil {
+		log.WithError(err).Warnln("unable to record results (see --no-history)")
+		return
+	}
+
+	defer s.Close()
+
+	if alerts != nil {
+		streaks = make(map[string]streak, len(results))
+		for target := range results {
+			last, since, err := s.Streak(target)
+			if err != nil {
+				log.WithError(err).Warnf("unable to read history of %s", target)
+				continue
+			}
+
+			streaks[target] = streak{last, since}
+		}
+	}
+
+	now := time.Now()
+	records := make(map[string]history.Record, len(results))
+	for target, found := range results {
+		records[target] = toRecord(now, found)
+	}
+
+	err = s.Add(records)
+	if err != nil {
+		log.WithError(err).Warnln("unable to record results (see --no-history)")
+	}
+
+	if retention > 0 {
+		removed, err := s.Prune(now.Add(-retention))
+		if err != nil {
+			log.WithError(err).Warnln("unable to prune history (see --history-retention)")
+		}
+
+		if removed > 0 {
+			log.Debugf("pruned %d records older than %v from history", removed, retention)
+		}
+	}
+
+	return
+}
+
+// parseDuration is time.ParseDuration, that also understands days (ex. 7d)
+func parseDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, err
+		}
+
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	return time.ParseDuration(s)
+}
+
+// parseSince converts `--since` into a point in time, see parseDuration()
+func parseSince(since string, fallback time.Duration) (time.Time, error) {
+	if since == "" {
+		if fallback == 0 {
+			return time.Time{}, nil
+		}
+
+		return time.Now().Add(-fallback), nil
+	}
+
+	d, err := parseDuration(since)
+	if err != nil {
+		return time.Time{}, errors.Errorf("invalid --since: %s", since)
+	}
+
+	return time.Now().Add(-d), nil
+}
+
+// runCommand outputs either all records of a single target (history), or a summary line per target (report)
+func runCommand() {
+	fallback := time.Duration(0)
+	if command == commandReport {
+		fallback = defaultReportSince
+	}
+
+	since, err := parseSince(opts.Since, fallback)
+	if err != nil {
+		fatal("%s", err)
+	}
+
+	if command == commandHistory && len(commandArgs) != 1 {
+		fatal("Exactly one address needs to be provided, ex. bc1isup history example.com:8333")
+	}
+
+	s, err := history.Open(historyPath())
+	if err != nil {
+		fatal("%s", err)
+	}
+
+	defer s.Close()
+
+	targets := commandArgs
+	if len(targets) == 0 {
+		targets, err = s.Targets()
+		if err != nil {
+			fatal("Unable to read history: %v", err)
+		}
+
+		sort.Strings(targets)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+
+	for _, target := range targets {
+		records, err := s.Get(target, since)
+		if err != nil {
+			fatal("Unable to read history: %v", err)
+		}
+
+		if command == commandHistory {
+			for _, r := range records {
+				err = enc.Encode(r)
+				if err != nil {
+					fatal("Unable to output history: %v", err)
+				}
+			}
+
+			continue
+		}
+
+		err = enc.Encode(history.Summarise(target, records))
+		if err != nil {
+			fatal("Unable to output report: %v", err)
+		}
+	}
+}
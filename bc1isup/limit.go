@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// first retry waits around that long, and each next one twice as long
+const retryBackoff = time.Second
+
+// limiter caps how many connections can be open at once, and how many can be opened per second
+type limiter struct {
+	slots chan struct{}
+
+	// nil if rate is not limited
+	ticks <-chan time.Time
+}
+
+var (
+	// connections made by all checks, set up in main()
+	dials *limiter
+
+	// targets, and IPs of domains with --resolve-all, checked at once, set up in main()
+	checks *limiter
+)
+
+func newLimiter(concurrency int, rate float64) *limiter {
+	l := &limiter{slots: make(chan struct{}, concurrency)}
+	if rate > 0 {
+		l.ticks = time.NewTicker(time.Duration(float64(time.Second) / rate)).C
+	}
+
+	return l
+}
+
+func (l *limiter) acquire() {
+	l.slots <- struct{}{}
+
+	if l.ticks != nil {
+		<-l.ticks
+	}
+}
+
+// tryAcquire takes a slot if one is free right away, and returns false otherwise.  Rate is not limited.
+func (l *limiter) tryAcquire() bool {
+	select {
+	case l.slots <- struct{}{}:
+		return true
+
+	default:
+		return false
+	}
+}
+
+func (l *limiter) release() {
+	<-l.slots
+}
+
+// backoff returns how long to wait before retry number attempt (starting at 1).  Delay doubles with each attempt, and
+// is randomised by up to half, so that retries of many targets don't happen all at once.
+func backoff(attempt int) time.Duration {
+	d := retryBackoff << uint(attempt-1)
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// speak exchanges version messages with a node at c, and retries up to --retries times if that fails.  Nodes found to
+// be on another network are not retried.
+func speak(dialer proxy.Dialer, c connstring.ConnString, testNet bool) (interface{}, error) {
+	return withRetries(c, func() (interface{}, error) {
+		return btc.SpeakTimeout(dialer, c, testNet, opts.Timeout)
+	})
+}
+
+// withRetries calls fn, that opens a single connection to c, and retries it up to --retries times if it fails
+func withRetries(c connstring.ConnString, fn func() (interface{}, error)) (out interface{}, err error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			delay := backoff(attempt)
+			common.Logger.Get().WithError(err).Debugf("retrying %s in %v", c.Raw, delay)
+			time.Sleep(delay)
+		}
+
+		dials.acquire()
+		out, err = fn()
+		dials.release()
+
+		if err == nil || attempt >= opts.Retries {
+			return
+		}
+
+		if _, ok := errors.Cause(err).(btc.NetworkError); ok {
+			return
+		}
+	}
+}
+
+// forEach calls fn for each of n targets, with at most --concurrency of them being checked at once, and returns once
+// all are done
+func forEach(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		checks.acquire()
+
+		go func(i int) {
+			defer func() {
+				checks.release()
+				wg.Done()
+			}()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
+
+// forEachSpare works like forEach, but is used within it.  fn is only called in parallel while some of --concurrency
+// slots are spare, and right away otherwise, as waiting for slots held by callers could never end.
+func forEachSpare(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	wg.Add(n)
+
+	for i := 0; i < n; i++ {
+		if !checks.tryAcquire() {
+			fn(i)
+			wg.Done()
+			continue
+		}
+
+		go func(i int) {
+			defer func() {
+				checks.release()
+				wg.Done()
+			}()
+
+			fn(i)
+		}(i)
+	}
+
+	wg.Wait()
+}
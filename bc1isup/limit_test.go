@@ -0,0 +1,49 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestForEach(t *testing.T) {
+	savedChecks := checks
+	defer func() { checks = savedChecks }()
+
+	for _, concurrency := range []int{1, 3} {
+		Convey("Given checks of domains nested in checks of targets", t, func() {
+			checks = newLimiter(concurrency, 0)
+
+			var (
+				mu            sync.Mutex
+				running, most int
+				called        int
+			)
+
+			forEach(4, func(int) {
+				forEachSpare(4, func(int) {
+					mu.Lock()
+					running++
+					called++
+					if running > most {
+						most = running
+					}
+					mu.Unlock()
+
+					time.Sleep(time.Millisecond)
+
+					mu.Lock()
+					running--
+					mu.Unlock()
+				})
+			})
+
+			Convey("all should be checked, with at most --concurrency at once", func() {
+				So(called, ShouldEqual, 16)
+				So(most, ShouldBeLessThanOrEqualTo, concurrency)
+			})
+		})
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// standard plugin exit codes, see https://nagios-plugins.org/doc/guidelines.html#AEN78
+const (
+	nagiosOk = iota
+	nagiosWarning
+	nagiosCritical
+	nagiosUnknown
+)
+
+var nagiosStates = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+type (
+	// nagiosFormatter summarises all targets in a single plugin output, and sets exit code according to thresholds
+	nagiosFormatter struct {
+		w       io.Writer
+		targets []string
+		results [][]interface{}
+		state   int
+	}
+
+	// nagiosCheck is a single value compared against thresholds.  Values above them are a problem, unless below is set.
+	// Infinite thresholds are disabled.
+	nagiosCheck struct {
+		label             string
+		value, warn, crit float64
+		below             bool
+		uom               string
+		min, max          string
+	}
+)
+
+func (c nagiosCheck) state() int {
+	exceeds := func(threshold float64) bool {
+		if c.below {
+			return c.value < threshold
+		}
+
+		return c.value > threshold
+	}
+
+	switch {
+	case exceeds(c.crit):
+		return nagiosCritical
+
+	case exceeds(c.warn):
+		return nagiosWarning
+	}
+
+	return nagiosOk
+}
+
+// perfData returns c in `'label'=value[UOM];[warn];[crit];[min];[max]` form
+func (c nagiosCheck) perfData() string {
+	threshold := func(t float64) string {
+		if math.IsInf(t, 0) {
+			return ""
+		}
+
+		return fmt.Sprintf("%g", t)
+	}
+
+	return fmt.Sprintf("%s=%g%s;%s;%s;%s;%s", c.label, c.value, c.uom, threshold(c.warn), threshold(c.crit), c.min, c.max)
+}
+
+// latencyThreshold returns t in seconds, where 0 disables it
+func latencyThreshold(t time.Duration) float64 {
+	if t <= 0 {
+		return math.Inf(1)
+	}
+
+	return t.Seconds()
+}
+
+func (f *nagiosFormatter) Write(target string, found []interface{}) error {
+	f.targets = append(f.targets, target)
+	f.results = append(f.results, found)
+	return nil
+}
+
+// Flush outputs the status line with performance data, followed by a line for each problem found
+func (f *nagiosFormatter) Flush() error {
+	tips := highestTips(f.results)
+
+	var (
+		up, maxLag int
+		maxLatency time.Duration
+		problems   []string
+	)
+
+	for i, found := range f.results {
+		if !isUp(found) {
+			problems = append(problems, fmt.Sprintf("%s is down", f.targets[i]))
+			continue
+		}
+
+		up++
+
+		lag := tipLag(found, tips)
+		if lag > maxLag {
+			maxLag = lag
+		}
+
+		if lag > opts.WarnLag {
+			problems = append(problems, fmt.Sprintf("%s is %d blocks behind", f.targets[i], lag))
+		}
+
+		for _, x := range found {
+			v, ok := asNode(x)
+			if !ok {
+				continue
+			}
+
+			if v.Latency > maxLatency {
+				maxLatency = v.Latency
+			}
+
+			if opts.WarnLatency > 0 && v.Latency > opts.WarnLatency {
+				problems = append(problems, fmt.Sprintf("%s took %v to respond", v.Address, v.Latency.Round(time.Microsecond)))
+			}
+		}
+	}
+
+	warnUp := opts.WarnUp
+	if warnUp == 0 {
+		warnUp = len(f.targets)
+	}
+
+	total := fmt.Sprint(len(f.targets))
+	checks := []nagiosCheck{
+		{label: "up", value: float64(up), warn: float64(warnUp), crit: float64(opts.CritUp), below: true, min: "0", max: total},
+		{label: "lag", value: float64(maxLag), warn: float64(opts.WarnLag), crit: float64(opts.CritLag), min: "0"},
+		{label: "latency", value: maxLatency.Seconds(), warn: latencyThreshold(opts.WarnLatency), crit: latencyThreshold(opts.CritLatency), uom: "s", min: "0"},
+	}
+
+	var perfData []string
+	for _, c := range checks {
+		if s := c.state(); s > f.state {
+			f.state = s
+		}
+
+		perfData = append(perfData, c.perfData())
+	}
+
+	_, err := fmt.Fprintf(f.w, "%s - %d/%d nodes up | %s\n", nagiosStates[f.state], up, len(f.targets), strings.Join(perfData, " "))
+	if err != nil {
+		return err
+	}
+
+	if len(problems) > 0 {
+		_, err = fmt.Fprintln(f.w, strings.Join(problems, "\n"))
+	}
+
+	return err
+}
+
+func (f *nagiosFormatter) ExitCode() int {
+	return f.state
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNagiosCheckState(t *testing.T) {
+	inf := math.Inf(1)
+
+	Convey("Values should be compared against thresholds", t, func() {
+		for _, tc := range []struct {
+			name  string
+			check nagiosCheck
+			state int
+		}{
+			{"above, within warn", nagiosCheck{value: 3, warn: 3, crit: 12}, nagiosOk},
+			{"above, past warn", nagiosCheck{value: 4, warn: 3, crit: 12}, nagiosWarning},
+			{"above, at crit", nagiosCheck{value: 12, warn: 3, crit: 12}, nagiosWarning},
+			{"above, past crit", nagiosCheck{value: 13, warn: 3, crit: 12}, nagiosCritical},
+			{"above, disabled", nagiosCheck{value: 1e9, warn: inf, crit: inf}, nagiosOk},
+			{"below, at warn", nagiosCheck{value: 5, warn: 5, crit: 1, below: true}, nagiosOk},
+			{"below, under warn", nagiosCheck{value: 4, warn: 5, crit: 1, below: true}, nagiosWarning},
+			{"below, at crit", nagiosCheck{value: 1, warn: 5, crit: 1, below: true}, nagiosWarning},
+			{"below, under crit", nagiosCheck{value: 0, warn: 5, crit: 1, below: true}, nagiosCritical},
+		} {
+			So(tc.check.state(), ShouldEqual, tc.state)
+		}
+	})
+}
+
+// nagiosNode returns results of a node at address, that took latency to respond
+func nagiosNode(address string, lastBlock int, latency time.Duration) []interface{} {
+	return []interface{}{btc.BitcoinVersion{Address: address, Version: 70016, LastBlock: lastBlock, Latency: latency}}
+}
+
+func nagiosDown(address string) []interface{} {
+	return []interface{}{nodeError{address, "connection refused"}}
+}
+
+// nagiosFlush returns the status line, and exit code of results written to a nagios formatter
+func nagiosFlush(results ...[]interface{}) (string, int) {
+	var b bytes.Buffer
+	f := &nagiosFormatter{w: &b}
+
+	for i, found := range results {
+		So(f.Write(fmt.Sprint("target-", i), found), ShouldBeNil)
+	}
+
+	So(f.Flush(), ShouldBeNil)
+	return strings.SplitN(b.String(), "\n", 2)[0], f.ExitCode()
+}
+
+func TestNagiosFormatter(t *testing.T) {
+	saved := opts
+	defer func() { opts = saved }()
+
+	const tip = 868123
+
+	for _, tc := range []struct {
+		name                     string
+		warnUp, critUp           int
+		warnLag, critLag         int
+		warnLatency, critLatency time.Duration
+		results                  [][]interface{}
+		status                   string
+		exitCode                 int
+	}{
+		{
+			name:    "all up, with WarnUp == 0 meaning all of them",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results: [][]interface{}{nagiosNode("a", tip, 0), nagiosNode("b", tip, 0)},
+			status:  "OK - 2/2 nodes up | up=2;2;1;0;2 lag=0;3;12;0; latency=0s;;;0;",
+		},
+		{
+			name:    "one down, with WarnUp == 0 meaning all of them",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results:  [][]interface{}{nagiosNode("a", tip, 0), nagiosDown("b")},
+			status:   "WARNING - 1/2 nodes up | up=1;2;1;0;2 lag=0;3;12;0; latency=0s;;;0;",
+			exitCode: nagiosWarning,
+		},
+		{
+			name:   "one down, with enough up for WarnUp",
+			warnUp: 1, critUp: 1,
+			warnLag: 3, critLag: 12,
+			results: [][]interface{}{nagiosNode("a", tip, 0), nagiosDown("b")},
+			status:  "OK - 1/2 nodes up | up=1;1;1;0;2 lag=0;3;12;0; latency=0s;;;0;",
+		},
+		{
+			name:    "all down",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results:  [][]interface{}{nagiosDown("a"), nagiosDown("b")},
+			status:   "CRITICAL - 0/2 nodes up | up=0;2;1;0;2 lag=0;3;12;0; latency=0s;;;0;",
+			exitCode: nagiosCritical,
+		},
+		{
+			name:    "lag at WarnLag",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results: [][]interface{}{nagiosNode("a", tip, 0), nagiosNode("b", tip-3, 0)},
+			status:  "OK - 2/2 nodes up | up=2;2;1;0;2 lag=3;3;12;0; latency=0s;;;0;",
+		},
+		{
+			name:    "lag past WarnLag",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results:  [][]interface{}{nagiosNode("a", tip, 0), nagiosNode("b", tip-4, 0)},
+			status:   "WARNING - 2/2 nodes up | up=2;2;1;0;2 lag=4;3;12;0; latency=0s;;;0;",
+			exitCode: nagiosWarning,
+		},
+		{
+			name:    "lag past CritLag",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results:  [][]interface{}{nagiosNode("a", tip, 0), nagiosNode("b", tip-13, 0)},
+			status:   "CRITICAL - 2/2 nodes up | up=2;2;1;0;2 lag=13;3;12;0; latency=0s;;;0;",
+			exitCode: nagiosCritical,
+		},
+		{
+			name:    "latency w/o thresholds",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			results: [][]interface{}{nagiosNode("a", tip, 5*time.Second)},
+			status:  "OK - 1/1 nodes up | up=1;1;1;0;1 lag=0;3;12;0; latency=5s;;;0;",
+		},
+		{
+			name:    "latency past WarnLatency",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			warnLatency: time.Second, critLatency: 3 * time.Second,
+			results:  [][]interface{}{nagiosNode("a", tip, 2*time.Second)},
+			status:   "WARNING - 1/1 nodes up | up=1;1;1;0;1 lag=0;3;12;0; latency=2s;1;3;0;",
+			exitCode: nagiosWarning,
+		},
+		{
+			name:    "latency past CritLatency",
+			critUp:  1,
+			warnLag: 3, critLag: 12,
+			warnLatency: time.Second, critLatency: 3 * time.Second,
+			results:  [][]interface{}{nagiosNode("a", tip, 4*time.Second)},
+			status:   "CRITICAL - 1/1 nodes up | up=1;1;1;0;1 lag=0;3;12;0; latency=4s;1;3;0;",
+			exitCode: nagiosCritical,
+		},
+		{
+			name:   "worst of all checks wins",
+			warnUp: 1, critUp: 1,
+			warnLag: 3, critLag: 12,
+			warnLatency: time.Second, critLatency: 3 * time.Second,
+			results:  [][]interface{}{nagiosNode("a", tip, 2*time.Second), nagiosNode("b", tip-13, 0)},
+			status:   "CRITICAL - 2/2 nodes up | up=2;1;1;0;2 lag=13;3;12;0; latency=2s;1;3;0;",
+			exitCode: nagiosCritical,
+		},
+	} {
+		Convey(tc.name, t, func() {
+			opts.WarnUp, opts.CritUp = tc.warnUp, tc.critUp
+			opts.WarnLag, opts.CritLag = tc.warnLag, tc.critLag
+			opts.WarnLatency, opts.CritLatency = tc.warnLatency, tc.critLatency
+
+			status, exitCode := nagiosFlush(tc.results...)
+			So(status, ShouldEqual, tc.status)
+			So(exitCode, ShouldEqual, tc.exitCode)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/rpc"
+	"github.com/meeDamian/bc1toolkit/lib/stratum"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	schemeStratum   = "stratum+tcp"
+	schemeStratumV2 = "stratum2+tcp"
+
+	// how tip of a pool compares to the one of --verify-tip node
+	tipCurrent = "current"
+	tipStale   = "stale"
+	tipFork    = "fork"
+	tipUnknown = "unknown"
+)
+
+// tipReference is the node tips of pools are compared against, only set with --verify-tip
+var tipReference *connstring.ConnString
+
+// checkStratum probes a Stratum V1, or V2 pool at c, and with --verify-tip, also whether it's mining on top of the
+// current tip.  Pools don't say which network they're on, so it's not checked.
+func checkStratum(dialers common.Dialers, dialer proxy.Dialer, c connstring.ConnString) []interface{} {
+	probe := stratum.Probe
+	if c.Scheme == schemeStratumV2 {
+		probe = stratum.ProbeV2
+	}
+
+	out, err := withRetries(c, func() (interface{}, error) {
+		return probe(dialer, c, opts.Timeout)
+	})
+	if err != nil {
+		return []interface{}{nodeError{c.Raw, err.Error()}}
+	}
+
+	p := out.(stratum.Pool)
+	if tipReference == nil {
+		return []interface{}{p}
+	}
+
+	err = verifyTip(dialers, &p)
+	if err != nil {
+		return []interface{}{p, nodeError{c.Raw, err.Error()}}
+	}
+
+	return []interface{}{p}
+}
+
+// verifyTip looks up block p is mining on top of in --verify-tip node, and returns an error unless it's the tip
+func verifyTip(dialers common.Dialers, p *stratum.Pool) error {
+	dialer, err := dialers.For(*tipReference)
+	if err != nil {
+		return errors.Wrap(err, "unable to reach --verify-tip node")
+	}
+
+	user, password, err := rpcCredentials(*tipReference)
+	if err != nil {
+		return err
+	}
+
+	client := rpc.NewClient(dialer, *tipReference, user, password, opts.Timeout)
+	defer client.Close()
+
+	var header struct {
+		Height        int `json:"height"`
+		Confirmations int `json:"confirmations"`
+	}
+
+	err = client.Call(&header, "getblockheader", p.PrevHash)
+	if e, ok := errors.Cause(err).(rpc.Error); ok && e.Code == rpc.CodeNotFound {
+		p.Tip = tipUnknown
+		return errors.Errorf("pool is mining on a block unknown to --verify-tip node: %s", p.PrevHash)
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "unable to verify tip")
+	}
+
+	if p.LastBlock == 0 {
+		p.LastBlock = header.Height
+	}
+
+	switch {
+	// blocks not on the active chain have -1 confirmations
+	case header.Confirmations < 0:
+		p.Tip = tipFork
+		return errors.Errorf("pool is mining on a stale fork, at height %d", header.Height)
+
+	case header.Confirmations > 1:
+		p.Tip, p.Behind = tipStale, header.Confirmations-1
+		return errors.Errorf("pool is mining on a stale tip: %d blocks behind", p.Behind)
+	}
+
+	p.Tip = tipCurrent
+	return nil
+}
+
+// parseTipReference validates --verify-tip
+func parseTipReference() error {
+	if opts.VerifyTip == "" {
+		return nil
+	}
+
+	c, err := connstring.Parse(opts.VerifyTip)
+	if err != nil || c.Scheme != schemeRPC {
+		return errors.New("--verify-tip has to be an rpc:// address, ex. rpc://localhost:8332")
+	}
+
+	tipReference = &c
+	return nil
+}
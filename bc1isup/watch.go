@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/rpc"
+)
+
+const (
+	// target is flapping, if it changed between up & down at least flapChanges times within its last flapWindow checks
+	flapWindow  = 10
+	flapChanges = 4
+
+	eventUp       = "up"
+	eventDown     = "down"
+	eventVersion  = "version"
+	eventLagging  = "lagging"
+	eventSynced   = "synced"
+	eventFlapping = "flapping"
+	eventStable   = "stable"
+	eventRemoved  = "removed"
+)
+
+type (
+	// event is output each time state of a watched target changes
+	event struct {
+		Time     time.Time     `json:"time"`
+		Address  string        `json:"address"`
+		Event    string        `json:"event"`
+		Up       bool          `json:"up"`
+		Previous string        `json:"previous,omitempty"`
+		Uptime   float64       `json:"uptime"`
+		Since    time.Time     `json:"since"`
+		LastSeen *time.Time    `json:"last_seen,omitempty"`
+		Flapping bool          `json:"flapping"`
+		TipLag   int           `json:"tip_lag,omitempty"`
+		Found    []interface{} `json:"found,omitempty"`
+	}
+
+	// watched is all that's known about a target across checks
+	watched struct {
+		checks, upChecks int
+
+		up, lagging, flapping bool
+		agents                string
+		since, lastSeen       time.Time
+
+		// when target was last checked, so that reminders are sent exactly once per --renotify
+		checked time.Time
+
+		// results of most recent checks, oldest first
+		history []bool
+	}
+)
+
+func status(up bool) string {
+	if up {
+		return eventUp
+	}
+
+	return eventDown
+}
+
+// agents returns a sorted list of user agents & protocol versions of all nodes found
+func agents(found []interface{}) string {
+	var list []string
+	for _, x := range found {
+		v, ok := asNode(x)
+		if !ok {
+			continue
+		}
+
+		// protocol version is only known for nodes
+		if v.Version == 0 {
+			list = append(list, v.UserAgent)
+			continue
+		}
+
+		list = append(list, fmt.Sprintf("%s (%d)", v.UserAgent, v.Version))
+	}
+
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// tipLag returns how many blocks the furthest behind node found is, compared to the highest tips seen
+func tipLag(found []interface{}, tips map[bool]int) (lag int) {
+	for _, x := range found {
+		v, ok := asNode(x)
+		if !ok {
+			continue
+		}
+
+		if l := tips[v.TestNet] - v.LastBlock; l > lag {
+			lag = l
+		}
+	}
+
+	return
+}
+
+// update records a result of a check, and returns all events it caused.  Changes between up & down are not reported
+// while target is flapping.
+func (w *watched) update(now time.Time, address string, found []interface{}, tips map[bool]int) (events []event) {
+	up := isUp(found)
+	first := w.checks == 0
+
+	// name of each event, and what it changed from
+	var changed [][2]string
+	defer func() {
+		for _, c := range changed {
+			events = append(events, w.event(now, address, c[0], c[1], found, tips))
+		}
+	}()
+
+	w.checks++
+	if up {
+		w.upChecks++
+		w.lastSeen = now
+	}
+
+	w.history = append(w.history, up)
+	if len(w.history) > flapWindow {
+		w.history = w.history[1:]
+	}
+
+	changes := 0
+	for i := 1; i < len(w.history); i++ {
+		if w.history[i] != w.history[i-1] {
+			changes++
+		}
+	}
+
+	flapping := changes >= flapChanges
+	switch {
+	case flapping && !w.flapping:
+		changed = append(changed, [2]string{eventFlapping, ""})
+
+	case !flapping && w.flapping:
+		changed = append(changed, [2]string{eventStable, ""})
+	}
+
+	if first || up != w.up {
+		w.since = now
+
+		previous := ""
+		if !first {
+			previous = status(w.up)
+		}
+
+		if !flapping && !w.flapping {
+			changed = append(changed, [2]string{status(up), previous})
+		}
+	}
+
+	w.up, w.flapping = up, flapping
+
+	// version & tip are only known when target is up
+	if !up {
+		return
+	}
+
+	a := agents(found)
+	if !first && w.agents != "" && a != w.agents {
+		changed = append(changed, [2]string{eventVersion, w.agents})
+	}
+
+	w.agents = a
+
+	lagging := tipLag(found, tips) > opts.MaxLag
+	switch {
+	case lagging && !w.lagging:
+		changed = append(changed, [2]string{eventLagging, ""})
+
+	case !lagging && w.lagging:
+		changed = append(changed, [2]string{eventSynced, ""})
+	}
+
+	w.lagging = lagging
+
+	return
+}
+
+func (w watched) event(now time.Time, address, name, previous string, found []interface{}, tips map[bool]int) event {
+	e := event{
+		Time:     now,
+		Address:  address,
+		Event:    name,
+		Up:       w.up,
+		Previous: previous,
+		Since:    w.since,
+		Flapping: w.flapping,
+		TipLag:   tipLag(found, tips),
+		Found:    found,
+	}
+
+	if w.checks > 0 {
+		e.Uptime = float64(w.upChecks) / float64(w.checks)
+	}
+
+	if !w.lastSeen.IsZero() {
+		lastSeen := w.lastSeen
+		e.LastSeen = &lastSeen
+	}
+
+	return e
+}
+
+// printEvent outputs e as a JSON line, regardless of --output, unless it's "simple" or "none"
+func printEvent(e event) {
+	switch opts.Output {
+	case "none":
+
+	case "simple":
+		fmt.Println(e.Address, e.Event)
+
+	default:
+		v, err := json.Marshal(e)
+		if err != nil {
+			common.Logger.Get().Errorf("unable to marshall event: %#v", e)
+			return
+		}
+
+		fmt.Println(string(v))
+	}
+}
+
+// checkAll checks all targets in parallel, up to --concurrency at once, and returns their results in the same order
+func checkAll(dialers common.Dialers, cs []connstring.ConnString) [][]interface{} {
+	results := make([][]interface{}, len(cs))
+
+	forEach(len(cs), func(i int) {
+		results[i] = checkTarget(dialers, cs[i], requestedNetworks())
+	})
+
+	return results
+}
+
+// highestTips returns the highest block seen on mainnet (false), and testnet (true)
+func highestTips(results [][]interface{}) map[bool]int {
+	tips := make(map[bool]int)
+	for _, found := range results {
+		for _, x := range found {
+			if v, ok := asNode(x); ok && v.LastBlock > tips[v.TestNet] {
+				tips[v.TestNet] = v.LastBlock
+			}
+
+			// nodes in IBD know how far behind they are from the headers they have
+			if r, ok := x.(rpc.Node); ok && r.Headers > tips[r.TestNet] {
+				tips[r.TestNet] = r.Headers
+			}
+		}
+	}
+
+	return tips
+}
+
+// watch checks all targets every --interval, and outputs changes of their state, until interrupted.  On SIGHUP,
+// targets are re-read, and checked right away.
+func watch(dialers common.Dialers, cs []connstring.ConnString) {
+	log := common.Logger.Get()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	ticker := time.NewTicker(opts.Interval)
+	defer ticker.Stop()
+
+	states := make(map[string]*watched)
+
+	for {
+		results := checkAll(dialers, cs)
+
+		// NOTE: tips are only taken from the current round, so that a single node reporting a bogus tip, or one
+		// that got reorged away, doesn't make all others lag for as long as watch runs
+		tips := highestTips(results)
+
+		now := time.Now()
+		recorded := make(map[string][]interface{}, len(cs))
+
+		for i, c := range cs {
+			recorded[c.Raw] = results[i]
+
+			w, ok := states[c.Raw]
+			if !ok {
+				w = &watched{}
+				states[c.Raw] = w
+			}
+
+			previous := w.checked
+			w.checked = now
+
+			events := w.update(now, c.Raw, results[i], tips)
+			for _, e := range events {
+				printEvent(e)
+				alertEvent(e)
+			}
+
+			if len(events) == 0 {
+				remindWatched(w, previous, w.event(now, c.Raw, eventDown, "", results[i], tips))
+			}
+		}
+
+		recordResults(recorded)
+
+		select {
+		case <-ticker.C:
+
+		case <-hup:
+			reloaded, err := targets()
+			if err != nil {
+				log.WithError(err).Warnln("unable to reload targets, keeping previous ones")
+				continue
+			}
+
+			current := make(map[string]bool)
+			for _, c := range reloaded {
+				current[c.Raw] = true
+			}
+
+			for address, w := range states {
+				if current[address] {
+					continue
+				}
+
+				printEvent(w.event(time.Now(), address, eventRemoved, "", nil, nil))
+				delete(states, address)
+			}
+
+			log.Infof("targets reloaded: %d", len(reloaded))
+			cs = reloaded
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const watchedAddress = "203.0.113.7:8333"
+
+func node(userAgent string, lastBlock int) []interface{} {
+	return []interface{}{btc.BitcoinVersion{Address: watchedAddress, UserAgent: userAgent, Version: 70016, LastBlock: lastBlock}}
+}
+
+func down() []interface{} {
+	return []interface{}{nodeError{watchedAddress, "connection refused"}}
+}
+
+// names returns names of events, in the order they were returned in
+func names(events []event) (out []string) {
+	for _, e := range events {
+		out = append(out, e.Event)
+	}
+
+	return
+}
+
+func TestWatchedUpdate(t *testing.T) {
+	opts.MaxLag = 2
+	start := time.Unix(1700000000, 0)
+	tips := map[bool]int{false: 868123}
+
+	Convey("Given a watched target", t, func() {
+		w := &watched{}
+		check := func(i int, found []interface{}) []event {
+			return w.update(start.Add(time.Duration(i)*time.Minute), watchedAddress, found, tips)
+		}
+
+		Convey("first check should report its state", func() {
+			events := check(0, node("/Satoshi:26.0.0/", 868123))
+
+			So(names(events), ShouldResemble, []string{eventUp})
+			So(events[0].Previous, ShouldBeEmpty)
+			So(events[0].Uptime, ShouldEqual, 1)
+
+			Convey("and nothing while it doesn't change", func() {
+				So(check(1, node("/Satoshi:26.0.0/", 868123)), ShouldBeEmpty)
+			})
+
+			Convey("going down should be reported w/ previous state", func() {
+				events := check(1, down())
+
+				So(names(events), ShouldResemble, []string{eventDown})
+				So(events[0].Previous, ShouldEqual, eventUp)
+				So(events[0].Uptime, ShouldEqual, 0.5)
+				So(*events[0].LastSeen, ShouldEqual, start)
+			})
+
+			Convey("version change should be reported w/ previous agents", func() {
+				events := check(1, node("/Satoshi:27.0.0/", 868123))
+
+				So(names(events), ShouldResemble, []string{eventVersion})
+				So(events[0].Previous, ShouldEqual, "/Satoshi:26.0.0/ (70016)")
+			})
+
+			Convey("version should not be reported as changed after being down", func() {
+				check(1, down())
+
+				So(names(check(2, node("/Satoshi:26.0.0/", 868123))), ShouldResemble, []string{eventUp})
+			})
+
+			Convey("falling more than --max-lag behind should be reported once", func() {
+				events := check(1, node("/Satoshi:26.0.0/", 868120))
+
+				So(names(events), ShouldResemble, []string{eventLagging})
+				So(events[0].TipLag, ShouldEqual, 3)
+				So(check(2, node("/Satoshi:26.0.0/", 868119)), ShouldBeEmpty)
+
+				Convey("and catching up too", func() {
+					So(names(check(3, node("/Satoshi:26.0.0/", 868122))), ShouldResemble, []string{eventSynced})
+				})
+			})
+		})
+
+		Convey("when it keeps going up & down", func() {
+			var all []string
+			for i := 0; i < 6; i++ {
+				found := node("/Satoshi:26.0.0/", 868123)
+				if i%2 == 1 {
+					found = down()
+				}
+
+				all = append(all, names(check(i, found))...)
+			}
+
+			Convey("it should be reported as flapping, and changes should not be reported anymore", func() {
+				So(all, ShouldResemble, []string{eventUp, eventDown, eventUp, eventDown, eventFlapping})
+				So(w.flapping, ShouldBeTrue)
+			})
+
+			Convey("once it stops, it should be reported as stable", func() {
+				var after []string
+				for i := 6; i < 6+flapWindow; i++ {
+					after = append(after, names(check(i, down()))...)
+				}
+
+				So(after, ShouldResemble, []string{eventStable})
+				So(w.flapping, ShouldBeFalse)
+
+				Convey("and changes reported again", func() {
+					So(names(check(20, node("/Satoshi:26.0.0/", 868123))), ShouldResemble, []string{eventUp})
+				})
+			})
+		})
+	})
+}
+
+func TestHighestTips(t *testing.T) {
+	Convey("Given a round with a node reporting a bogus tip", t, func() {
+		round := [][]interface{}{node("/Satoshi:26.0.0/", 868123), node("/Bogus:0.1/", 999999999)}
+
+		So(highestTips(round), ShouldResemble, map[bool]int{false: 999999999})
+
+		Convey("once it's gone, others should not lag behind it anymore", func() {
+			next := [][]interface{}{node("/Satoshi:26.0.0/", 868124), down()}
+
+			So(highestTips(next), ShouldResemble, map[bool]int{false: 868124})
+			So(tipLag(next[0], highestTips(next)), ShouldEqual, 0)
+		})
+	})
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/dnsseed"
+	"github.com/meeDamian/bc1toolkit/lib/help"
+)
+
+const (
+	BinaryName = "bc1seeds"
+
+	description = `Queries Bitcoin DNS seeds, and checks all nodes they return. If no seeds are provided, ones used by Bitcoin Core are checked.
+
+Each seed is queried for each of --services, and each query outputs its own line with seed's health (customizable with --output=?).  A seed is healthy when it returns any nodes, at least --min-reachable of them are up, and at least --min-services of these advertise all requested services.
+Exit code of 0 is returned only if all queries were healthy.`
+
+	torBehaviour = `tries using Tor, if not available, falls back to clearnet.`
+)
+
+type (
+	// probe is a result of a single node check, shared by all seeds that returned it
+	probe struct {
+		once     sync.Once
+		services uint64
+		err      error
+	}
+
+	seedResult struct {
+		dnsseed.Result
+		Healthy bool `json:"healthy"`
+	}
+)
+
+var (
+	commonOpts help.Opts
+
+	opts struct {
+		TestNet      bool     `long:"testnet" short:"T" description:"Check testnet seeds & nodes"`
+		Services     []string `long:"services" short:"s" description:"Service bits (in hex, as in seeds' x<hex> subdomains) to query seeds for. 0 is no filter, and nodes are then expected to be NODE_NETWORK" default:"0" default:"9"`
+		DnsServer    string   `long:"dns-server" description:"\"host:port\" of a DNS server to query, ex. seeder's own. If not set, system resolver is used, or 1.1.1.1:53 when through Tor"`
+		MinReachable float64  `long:"min-reachable" description:"Minimum fraction of returned nodes that have to be up" default:"0.5"`
+		MinServices  float64  `long:"min-services" description:"Minimum fraction of up nodes that have to advertise all requested services" default:"0.9"`
+		Nodes        bool     `long:"nodes" description:"Include status of each node returned in the output"`
+		Output       string   `long:"output" short:"o" description:"Choose line format: 'json' for JSON object. 'simple' for a seed name, followed by \"healthy\" or \"unhealthy\". 'none' for no output, and only exit code" default:"json" choice:"json" choice:"simple" choice:"none"`
+	}
+
+	seeds    []string
+	services []uint64
+
+	probesMu sync.Mutex
+	probes   = make(map[string]*probe)
+)
+
+// NOTE: all errors returned here are quoted strings to preserve `jq` compatibility
+func init() {
+	common.Logger.Name(BinaryName)
+
+	help.Customize(
+		"[OPTIONS] [seed ...]",
+		description,
+		torBehaviour,
+		BinaryName, &opts,
+	)
+
+	seeds, commonOpts = help.Parse()
+
+	if len(seeds) == 0 {
+		seeds = dnsseed.MainNetSeeds
+		if opts.TestNet {
+			seeds = dnsseed.TestNetSeeds
+		}
+	}
+
+	for _, s := range opts.Services {
+		bits, err := dnsseed.ParseServices(s)
+		if err != nil {
+			fmt.Printf(`"--services=%s is not valid hex"`+"\n", s)
+			os.Exit(1)
+		}
+
+		services = append(services, bits)
+	}
+}
+
+// prober returns a dnsseed.Prober, that checks each node only once, no matter how many seeds return it
+func prober(dialers common.Dialers) dnsseed.Prober {
+	return func(c connstring.ConnString) (uint64, error) {
+		probesMu.Lock()
+		p, ok := probes[c.ToString()]
+		if !ok {
+			p = &probe{}
+			probes[c.ToString()] = p
+		}
+		probesMu.Unlock()
+
+		p.once.Do(func() {
+			dialer, err := dialers.For(c)
+			if err != nil {
+				p.err = err
+				return
+			}
+
+			version, err := btc.Speak(dialer, c, opts.TestNet)
+			if err != nil {
+				p.err = err
+				return
+			}
+
+			p.services = version.(btc.BitcoinVersion).Services
+		})
+
+		return p.services, p.err
+	}
+}
+
+func lookup(dialers common.Dialers) (dnsseed.Lookup, error) {
+	if opts.DnsServer == "" {
+		return dialers.Lookup(common.DefaultDnsServer), nil
+	}
+
+	server, err := connstring.Parse(opts.DnsServer)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer, err := dialers.For(server)
+	if err != nil {
+		return nil, err
+	}
+
+	return common.LookupVia(dialer, opts.DnsServer), nil
+}
+
+func main() {
+	config := commonOpts.DialersConfig()
+	config.Timeout = btc.DefaultTimeout
+
+	dialers, err := common.GetDialers(config)
+	if err != nil {
+		fmt.Printf(`"%s"`+"\n", err)
+		os.Exit(1)
+	}
+
+	lookupFn, err := lookup(dialers)
+	if err != nil {
+		fmt.Printf(`"--dns-server=%s is not valid: %v"`+"\n", opts.DnsServer, err)
+		os.Exit(1)
+	}
+
+	port := "8333"
+	if opts.TestNet {
+		port = "18333"
+	}
+
+	probeFn := prober(dialers)
+
+	// check all seeds in parallel, but output in the order provided
+	results := make([]dnsseed.Result, len(seeds)*len(services))
+
+	var wg sync.WaitGroup
+	wg.Add(len(results))
+
+	for i, seed := range seeds {
+		for j, bits := range services {
+			go func(n int, seed string, bits uint64) {
+				defer wg.Done()
+
+				results[n] = dnsseed.Check(seed, bits, port, lookupFn, probeFn)
+			}(i*len(services)+j, seed, bits)
+		}
+	}
+
+	wg.Wait()
+
+	exitCode := 0
+	for _, r := range results {
+		healthy := r.Healthy(opts.MinReachable, opts.MinServices)
+		if !healthy {
+			exitCode = 1
+		}
+
+		if !opts.Nodes {
+			r.Nodes = nil
+		}
+
+		switch opts.Output {
+		case "simple":
+			status := "healthy"
+			if !healthy {
+				status = "unhealthy"
+			}
+
+			fmt.Println(r.Query, status)
+
+		case "json":
+			v, err := json.Marshal(seedResult{r, healthy})
+			if err != nil {
+				exitCode = 1
+
+				common.Logger.Get().Errorf("unable to marshall response: %#v", r)
+				fmt.Println(`{"error": "unable to marshall response"}`)
+				continue
+			}
+
+			fmt.Println(string(v))
+		}
+	}
+
+	os.Exit(exitCode)
+}
@@ -0,0 +1,124 @@
+package alert
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var testAlert = Alert{
+	Time:     time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	Address:  "6g3y7ahr5uxjzedgmu5etxtrc6hqmb2bl7kyipl3nzrcnyp64afrfwyd.onion",
+	Event:    "down",
+	Previous: "up",
+	Details:  []string{"timeout"},
+}
+
+func TestWebhook(t *testing.T) {
+	received := make(chan Alert, 1)
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var a Alert
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.NewDecoder(r.Body).Decode(&a) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		received <- a
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	Convey("Given a webhook", t, func() {
+		w := Webhook{URL: server.URL}
+
+		Convey("alert should be POSTed as JSON", func() {
+			So(w.Notify(testAlert), ShouldBeNil)
+
+			a := <-received
+			So(a.Address, ShouldEqual, testAlert.Address)
+			So(a.Event, ShouldEqual, "down")
+			So(a.Previous, ShouldEqual, "up")
+		})
+
+		Convey("non-2xx response should fail", func() {
+			status = http.StatusInternalServerError
+			defer func() { status = http.StatusOK }()
+
+			err := w.Notify(testAlert)
+			<-received
+
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "500")
+		})
+	})
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("needs sh")
+	}
+
+	dir, err := ioutil.TempDir("", "alert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Given an exec hook", t, func() {
+		out := filepath.Join(dir, "out")
+
+		Convey("details should be passed in environment", func() {
+			e := Exec{Command: `echo "$BC1_ADDRESS $BC1_EVENT $BC1_PREVIOUS $BC1_UP" > ` + out}
+			So(e.Notify(testAlert), ShouldBeNil)
+
+			b, err := ioutil.ReadFile(out)
+			So(err, ShouldBeNil)
+			So(strings.TrimSpace(string(b)), ShouldEqual, testAlert.Address+" down up false")
+		})
+
+		Convey("failing command should fail with its output", func() {
+			err := Exec{Command: "echo nope; exit 3"}.Notify(testAlert)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "nope")
+		})
+	})
+}
+
+func TestSilences(t *testing.T) {
+	Convey("Given silences", t, func() {
+		s := make(Silences)
+		So(s.Parse("a.example"), ShouldBeNil)
+		So(s.Parse("[2606:4700::1111]:8333=2026-01-02T00:00:00Z"), ShouldBeNil)
+		So(s.Parse("b.example=tomorrow"), ShouldNotBeNil)
+
+		now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		So(s.Silenced("a.example", now), ShouldBeTrue)
+		So(s.Silenced("[2606:4700::1111]:8333", now), ShouldBeTrue)
+		So(s.Silenced("[2606:4700::1111]:8333", now.Add(48*time.Hour)), ShouldBeFalse)
+		So(s.Silenced("c.example", now), ShouldBeFalse)
+	})
+}
+
+func TestShouldRemind(t *testing.T) {
+	Convey("Given a target down since midnight, and hourly reminders", t, func() {
+		since := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		at := func(m int) time.Time { return since.Add(time.Duration(m) * time.Minute) }
+
+		So(ShouldRemind(since, at(50), at(55), time.Hour), ShouldBeFalse)
+		So(ShouldRemind(since, at(55), at(60), time.Hour), ShouldBeTrue)
+		So(ShouldRemind(since, at(60), at(65), time.Hour), ShouldBeFalse)
+		So(ShouldRemind(since, at(100), at(190), time.Hour), ShouldBeTrue)
+		So(ShouldRemind(since, at(55), at(60), 0), ShouldBeFalse)
+	})
+}
@@ -0,0 +1,222 @@
+package bech32
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	checksumLen = 6
+
+	// Limit defined by BIP-173.  LN invoices are exempt from it, and should be decoded with DecodeNoLimit().
+	MaxLength = 90
+
+	bech32Const  uint32 = 1
+	bech32mConst uint32 = 0x2bc830a3
+)
+
+const (
+	_ = iota
+	Bech32
+	Bech32m
+)
+
+var generator = []uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+func polymod(values []byte) uint32 {
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+
+		for i, g := range generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+
+	return chk
+}
+
+func hrpExpand(hrp string) []byte {
+	out := make([]byte, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		out = append(out, byte(c>>5))
+	}
+
+	out = append(out, 0)
+
+	for _, c := range hrp {
+		out = append(out, byte(c&31))
+	}
+
+	return out
+}
+
+func createChecksum(hrp string, data []byte, encoding int) []byte {
+	c := bech32Const
+	if encoding == Bech32m {
+		c = bech32mConst
+	}
+
+	values := append(hrpExpand(hrp), data...)
+	values = append(values, make([]byte, checksumLen)...)
+	mod := polymod(values) ^ c
+
+	checksum := make([]byte, checksumLen)
+	for i := range checksum {
+		checksum[i] = byte((mod >> uint(5*(5-i))) & 31)
+	}
+
+	return checksum
+}
+
+// Encode returns bech32 (or bech32m) string made out of hrp and a slice of 5-bit groups
+func Encode(hrp string, data []byte, encoding int) (string, error) {
+	var sb strings.Builder
+	sb.WriteString(hrp)
+	sb.WriteByte('1')
+
+	checksum := createChecksum(hrp, data, encoding)
+	for _, d := range append(append([]byte{}, data...), checksum...) {
+		if d > 31 {
+			return "", errors.Errorf("invalid 5-bit group value: %d", d)
+		}
+
+		sb.WriteByte(charset[d])
+	}
+
+	return sb.String(), nil
+}
+
+// Decode splits a bech32 string into hrp and 5-bit groups, and verifies its checksum
+func Decode(s string) (hrp string, data []byte, encoding int, err error) {
+	if len(s) > MaxLength {
+		return "", nil, 0, errors.Errorf("string too long: %d > %d", len(s), MaxLength)
+	}
+
+	return DecodeNoLimit(s)
+}
+
+// DecodeNoLimit works just like Decode() but without enforcing the BIP-173 length limit
+func DecodeNoLimit(s string) (hrp string, data []byte, encoding int, err error) {
+	hrp, data, err = split(s)
+	if err != nil {
+		return
+	}
+
+	if len(data) < checksumLen {
+		return "", nil, 0, errors.New("string too short to contain a checksum")
+	}
+
+	switch polymod(append(hrpExpand(hrp), data...)) {
+	case bech32Const:
+		encoding = Bech32
+
+	case bech32mConst:
+		encoding = Bech32m
+
+	default:
+		return "", nil, 0, errors.New("invalid checksum")
+	}
+
+	return hrp, data[:len(data)-checksumLen], encoding, nil
+}
+
+// DecodeNoChecksum splits a string into hrp and 5-bit groups.  It's used by BOLT-12 strings that skip the checksum.
+func DecodeNoChecksum(s string) (hrp string, data []byte, err error) {
+	return split(s)
+}
+
+func split(s string) (hrp string, data []byte, err error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("mixed case strings are not allowed")
+	}
+
+	s = strings.ToLower(s)
+
+	pos := strings.LastIndexByte(s, '1')
+	if pos < 1 {
+		return "", nil, errors.New("missing or empty human-readable part")
+	}
+
+	hrp = s[:pos]
+	for _, c := range hrp {
+		if c < 33 || c > 126 {
+			return "", nil, errors.Errorf("invalid human-readable part character: %q", c)
+		}
+	}
+
+	for _, c := range s[pos+1:] {
+		d := strings.IndexRune(charset, c)
+		if d == -1 {
+			return "", nil, errors.Errorf("invalid data character: %q", c)
+		}
+
+		data = append(data, byte(d))
+	}
+
+	return
+}
+
+// ConvertBits regroups bits of each element in data from fromBits into toBits.  When converting to bytes pad should
+// be false, and any non-zero padding is treated as an error.
+func ConvertBits(data []byte, fromBits, toBits uint, pad bool) ([]byte, error) {
+	var (
+		acc  uint32
+		bits uint
+		out  []byte
+	)
+
+	maxValue := uint32(1)<<toBits - 1
+	for _, d := range data {
+		if uint32(d)>>fromBits != 0 {
+			return nil, errors.Errorf("invalid %d-bit group value: %d", fromBits, d)
+		}
+
+		acc = acc<<fromBits | uint32(d)
+		bits += fromBits
+
+		for bits >= toBits {
+			bits -= toBits
+			out = append(out, byte(acc>>bits&maxValue))
+		}
+	}
+
+	if pad {
+		if bits > 0 {
+			out = append(out, byte(acc<<(toBits-bits)&maxValue))
+		}
+
+		return out, nil
+	}
+
+	if bits >= fromBits {
+		return nil, errors.New("too much padding")
+	}
+
+	if acc<<(toBits-bits)&maxValue != 0 {
+		return nil, errors.New("non-zero padding")
+	}
+
+	return out, nil
+}
+
+// EncodeSegWit returns a segwit address for a given network hrp, witness version & program
+func EncodeSegWit(hrp string, version byte, program []byte) (string, error) {
+	data, err := ConvertBits(program, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	encoding := Bech32
+	if version > 0 {
+		encoding = Bech32m
+	}
+
+	return Encode(hrp, append([]byte{version}, data...), encoding)
+}
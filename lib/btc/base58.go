@@ -0,0 +1,45 @@
+package btc
+
+import "math/big"
+
+const (
+	base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+	// legacy address version bytes
+	P2PKHMainNet byte = 0x00
+	P2SHMainNet  byte = 0x05
+	P2PKHTestNet byte = 0x6f
+	P2SHTestNet  byte = 0xc4
+)
+
+func Base58Encode(b []byte) string {
+	x := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+
+	var out []byte
+	for x.Sign() > 0 {
+		x.DivMod(x, radix, mod)
+		out = append(out, base58Alphabet[mod.Int64()])
+	}
+
+	// each leading zero byte is encoded as a '1'
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+
+		out = append(out, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return string(out)
+}
+
+func Base58CheckEncode(version byte, payload []byte) string {
+	b := append([]byte{version}, payload...)
+	return Base58Encode(append(b, DoubleSha256(b)[:4]...))
+}
@@ -0,0 +1,32 @@
+package btc
+
+import "strings"
+
+// Names of networks, as used by Bitcoin Core, ex. in `getblockchaininfo`
+const (
+	ChainMain     = "main"
+	ChainTest     = "test"
+	ChainTestnet4 = "testnet4"
+	ChainSignet   = "signet"
+	ChainRegtest  = "regtest"
+)
+
+// GenesisHashes are hashes of genesis blocks of all networks, in the byte order used by RPCs & block explorers
+var GenesisHashes = map[string]string{
+	ChainMain:     "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f",
+	ChainTest:     "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943",
+	ChainTestnet4: "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043",
+	ChainSignet:   "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6",
+	ChainRegtest:  "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206",
+}
+
+// ChainOf returns name of the network with genesis block of given hash, or "" if it's not known
+func ChainOf(genesisHash string) string {
+	for chain, hash := range GenesisHashes {
+		if strings.EqualFold(hash, genesisHash) {
+			return chain
+		}
+	}
+
+	return ""
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/meeDamian/bc1toolkit/lib/common"
 	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/net/proxy"
@@ -36,11 +37,25 @@ type BitcoinVersion struct {
 	Address   string `json:"address"`
 	UserAgent string `json:"useragent"`
 	Version   int    `json:"protocol"`
+	Services  uint64 `json:"services"`
 	LastBlock int    `json:"lastblock"`
 	TestNet   bool   `json:"testnet"`
+
+	// Latency is how long it took to connect, and exchange version messages
+	Latency time.Duration `json:"-"`
 }
 
-var defaultTimeout = time.Duration(5 * time.Second)
+// DefaultTimeout is how long connecting to a peer, and exchanging version messages can take in total
+const DefaultTimeout = 10 * time.Second
+
+// NetworkError is returned when peer responds with a magic of another Bitcoin network
+type NetworkError struct {
+	Expected, Returned uint32
+}
+
+func (e NetworkError) Error() string {
+	return fmt.Sprintf("peer node responded with a unexpected network magic (expected:%02x, returned:%02x)", e.Expected, e.Returned)
+}
 
 func getNetworkMagic(testNet bool) uint32 {
 	if testNet {
@@ -125,7 +140,7 @@ func readHeader(header [HeaderSize]byte) (magic uint32, command string, length u
 	magic = binary.LittleEndian.Uint32(header[:4])
 	header2 := header[4:]
 
-	command = string(bytes.TrimRight(header2[:CommandSize], string(0)))
+	command = string(bytes.TrimRight(header2[:CommandSize], "\x00"))
 	header2 = header2[CommandSize:]
 
 	length = binary.LittleEndian.Uint32(header2[:4])
@@ -189,7 +204,7 @@ func readVersionMsg(msg []byte) (btcVersion BitcoinVersion) {
 	btcVersion.Version = int(binary.LittleEndian.Uint32(msg[:4]))
 	msg = msg[4:]
 
-	//services = binary.LittleEndian.Uint64(msg[:8])
+	btcVersion.Services = binary.LittleEndian.Uint64(msg[:8])
 	msg = msg[8:]
 
 	//ts = time.Time(time.Unix(int64(binary.LittleEndian.Uint64(msg[:8])), 0))
@@ -210,7 +225,7 @@ func readVersionMsg(msg []byte) (btcVersion BitcoinVersion) {
 	length := uint8(msg[0])
 	if length == 0xff || length == 0xfe || length == 0xfd {
 		// TODO: fixme
-		fmt.Errorf("long (%d) useragents not yet supported…", length)
+		common.Logger.Get().Debugf("long (%d) useragents not yet supported…", length)
 		return
 	}
 	msg = msg[1:]
@@ -225,18 +240,18 @@ func readVersionMsg(msg []byte) (btcVersion BitcoinVersion) {
 	return
 }
 
-func sendMessage(dialer proxy.Dialer, addr connstring.ConnString, header, msg []byte, testNet bool) (btcVersion BitcoinVersion, err error) {
+func sendMessage(dialer proxy.Dialer, addr connstring.ConnString, header, msg []byte, testNet bool, until time.Time) (btcVersion BitcoinVersion, err error) {
 	log := common.Logger.Get().WithField("address", addr.Raw)
 
 	log.Debugln("connecting…")
-	conn, err := dialer.Dial("tcp", net.JoinHostPort(addr.Host, addr.Port))
+	conn, err := deadline.Dial(dialer, "tcp", net.JoinHostPort(addr.Host, addr.Port), until)
 	if err != nil {
 		return btcVersion, errors.Wrap(err, "can't connect to peer")
 	}
 	log.Debugln("connection ok")
 
-	conn.SetDeadline(time.Now().Add(defaultTimeout))
-	log.Debugf("read/write deadline set to %v", defaultTimeout)
+	conn.SetDeadline(until)
+	log.Debugf("read/write deadline set to %v", until)
 
 	defer conn.Close()
 
@@ -277,7 +292,7 @@ func sendMessage(dialer proxy.Dialer, addr connstring.ConnString, header, msg []
 	}
 
 	if magic != getNetworkMagic(testNet) {
-		return btcVersion, errors.Errorf("peer node responded with a unexpected network magic (expected:%02x, returned:%02x)", getNetworkMagic(testNet), magic)
+		return btcVersion, NetworkError{getNetworkMagic(testNet), magic}
 	}
 
 	if command != VersionCommand {
@@ -304,6 +319,7 @@ func sendMessage(dialer proxy.Dialer, addr connstring.ConnString, header, msg []
 	nodeInfo := readVersionMsg(respMsg)
 	log.WithFields(logrus.Fields{
 		"version":   nodeInfo.Version,
+		"services":  nodeInfo.Services,
 		"useragent": nodeInfo.UserAgent,
 		"lastblock": nodeInfo.LastBlock,
 	}).Debugln("peer payload processed")
@@ -312,8 +328,15 @@ func sendMessage(dialer proxy.Dialer, addr connstring.ConnString, header, msg []
 }
 
 func Speak(dialer proxy.Dialer, addr connstring.ConnString, testNet bool) (interface{}, error) {
-	if addr.Type == connstring.TypeTorV3 {
-		return BitcoinVersion{}, errors.New("Bitcoin network doesn't support Tor v3 addresses yet")
+	return SpeakTimeout(dialer, addr, testNet, DefaultTimeout)
+}
+
+// SpeakTimeout is Speak, that gives up after timeout.  Proxies must be set up with deadline.Dialer for their
+// handshakes to be bounded too (see common.GetDialers()).
+func SpeakTimeout(dialer proxy.Dialer, addr connstring.ConnString, testNet bool, timeout time.Duration) (interface{}, error) {
+	if addr.Port == "" && addr.IsI2P() {
+		// I2P has no ports; Bitcoin Core expects 0
+		addr.Port = "0"
 	}
 
 	if addr.Port == "" {
@@ -327,35 +350,20 @@ func Speak(dialer proxy.Dialer, addr connstring.ConnString, testNet bool) (inter
 	msg := buildVersionMsg(addr.IP, addr.Port)
 	header := buildVersionHeader(msg, testNet)
 
-	v := make(chan BitcoinVersion, 1)
-	e := make(chan error, 1)
-
-	go func() {
-		version, err := sendMessage(dialer, addr, header, msg, testNet)
-		if err != nil {
-			e <- err
-			return
-		}
-
-		if version == (BitcoinVersion{}) {
-			e <- errors.New("empty version returned")
-			return
-		}
-
-		version.Address = addr.ToString()
-		version.TestNet = testNet
-
-		v <- version
-	}()
-
-	select {
-	case version := <-v:
-		return version, nil
+	start := time.Now()
 
-	case err := <-e:
+	version, err := sendMessage(dialer, addr, header, msg, testNet, start.Add(timeout))
+	if err != nil {
 		return BitcoinVersion{}, err
+	}
 
-	case <-time.After(2 * defaultTimeout):
-		return BitcoinVersion{}, errors.New("timeout")
+	if version == (BitcoinVersion{}) {
+		return BitcoinVersion{}, errors.New("empty version returned")
 	}
+
+	version.Address = addr.ToString()
+	version.TestNet = testNet
+	version.Latency = time.Since(start)
+
+	return version, nil
 }
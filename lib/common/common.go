@@ -1,8 +1,14 @@
 package common
 
 import (
+	"context"
+	"net"
 	"path"
+	"sync"
+	"time"
 
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/i2p"
 	"github.com/meeDamian/bc1toolkit/lib/tor"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -12,13 +18,49 @@ import (
 const (
 	cacheDir      = "com.meedamian.bc1toolkit"
 	DefaultConfig = "./bc1toolkit.conf"
+
+	// DefaultDnsServer is queried over TCP, when names are resolved through a proxy, and no DNS server was given
+	DefaultDnsServer = "1.1.1.1:53"
+
+	// building circuits to exit nodes can take a while
+	lookupTimeout = 30 * time.Second
 )
 
 type (
 	Dialers struct {
-		Tor      proxy.Dialer
 		ClearNet proxy.Dialer
-		mode     string
+		Proxy    proxy.Dialer
+
+		// Tor & I2P are only set up once first needed, as both can take a while
+		tor *lazyDialer
+		i2p *lazyDialer
+
+		// first rule matching a target decides how it's dialled
+		rules []Rule
+	}
+
+	lazyDialer struct {
+		once   sync.Once
+		init   func() (proxy.Dialer, error)
+		dialer proxy.Dialer
+		err    error
+	}
+
+	// Config describes which dialers to create, and how to route connections through them
+	Config struct {
+		TorMode string
+		Tor     tor.Config
+		I2PSam  string
+
+		// URL of a generic, non-Tor proxy, see NewProxy()
+		Proxy string
+
+		// rules (see ParseRule()), that take precedence over ones implied by TorMode & Proxy
+		Routes []string
+
+		// how long connecting through Tor, I2P, or a proxy can take, incl. their handshakes.  Zero means no limit,
+		// other than their own.
+		Timeout time.Duration
 	}
 
 	logger struct {
@@ -48,57 +90,180 @@ func (l *logger) SetLevel(level logrus.Level) {
 
 var Logger logger
 
-func (d Dialers) Default(isTor, isLocal bool) (proxy.Dialer, error) {
-	if isLocal {
-		return d.ClearNet, nil
-	}
+func (l *lazyDialer) get() (proxy.Dialer, error) {
+	l.once.Do(func() {
+		l.dialer, l.err = l.init()
+	})
 
-	if d.mode == "never" && isTor {
-		return nil, errors.New("can't check .onion addresses with --tor-mode=never")
-	}
+	return l.dialer, l.err
+}
+
+// Tor returns a verified Tor dialer, or an error if there's none
+func (d Dialers) Tor() (proxy.Dialer, error) {
+	return d.tor.get()
+}
+
+// I2P returns a dialer with an I2P session created, or an error if it can't be
+func (d Dialers) I2P() (proxy.Dialer, error) {
+	return d.i2p.get()
+}
 
-	if d.mode == "native" && isTor {
-		if d.Tor == nil {
-			return nil, errors.New("can't check .onion addresses with Tor unavailable")
+// Lookup returns a function returning A & AAAA records of a host.  If connections to host would go through Tor, or a
+// proxy, so do DNS queries: over TCP, to dnsServer.  W/o dnsServer, Tor resolves host itself (RESOLVE), but returns
+// only a single address, and other proxies use DefaultDnsServer.  Otherwise the system resolver is used.
+func (d Dialers) Lookup(dnsServer string) func(host string) ([]net.IP, error) {
+	return func(host string) ([]net.IP, error) {
+		c, err := connstring.Parse(host)
+		if err != nil {
+			return nil, err
 		}
 
-		return d.Tor, nil
-	}
+		r, dialer := d.Explain(c)
+		if dialer == nil {
+			return nil, errors.New(r.Error)
+		}
+
+		if dialer == d.ClearNet {
+			return net.LookupIP(host)
+		}
+
+		if p, ok := dialer.(*tor.Proxy); ok {
+			if dnsServer == "" {
+				return p.Resolve(host)
+			}
 
-	if d.mode == "auto" && d.Tor != nil {
-		return d.Tor, nil
+			dialer = p.For(host)
+		}
+
+		if dnsServer == "" {
+			dnsServer = DefaultDnsServer
+		}
+
+		return LookupVia(dialer, dnsServer)(host)
 	}
+}
+
+// LookupVia returns a function returning all A & AAAA records of a host, as returned by dnsServer.  Unless dialer is
+// proxy.Direct, queries are sent over TCP.
+func LookupVia(dialer proxy.Dialer, dnsServer string) func(host string) ([]net.IP, error) {
+	// NOTE: stream connection makes resolver use DNS over TCP, and it's always dialled to dnsServer, no matter what
+	// system's resolv.conf says
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			if dialer == proxy.Direct {
+				var d net.Dialer
+				return d.DialContext(ctx, network, dnsServer)
+			}
 
-	if d.mode == "always" {
-		return d.Tor, nil
+			return dialer.Dial("tcp", dnsServer)
+		},
 	}
 
-	return d.ClearNet, nil
+	return func(host string) ([]net.IP, error) {
+		ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+		defer cancel()
+
+		addrs, err := r.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't resolve %s with %s", host, dnsServer)
+		}
+
+		var ips []net.IP
+		for _, addr := range addrs {
+			ips = append(ips, addr.IP)
+		}
+
+		return ips, nil
+	}
 }
 
-func GetDialers(torMode string, torSocks []string) (d Dialers, _ error) {
+// GetDialers returns dialers requested, and rules routing targets to them.  Tor & I2P are only set up once any target
+// is routed to them, and I2P only if config.I2PSam is not empty.
+func GetDialers(config Config) (d Dialers, _ error) {
 	d = Dialers{
-		mode:     torMode,
 		ClearNet: proxy.Direct,
 	}
 
-	if torMode == "never" {
-		return
+	config.Tor.Timeout = config.Timeout
+
+	for _, raw := range config.Routes {
+		rule, err := ParseRule(raw)
+		if err != nil {
+			return Dialers{}, err
+		}
+
+		if contains(rule.Dialers, DialerProxy) && config.Proxy == "" {
+			return Dialers{}, errors.Errorf("route %s uses proxy, but --proxy is not set", raw)
+		}
+
+		d.rules = append(d.rules, rule)
 	}
 
-	torDialer, err := tor.GetWorkingTor(torSocks)
-	if err != nil {
-		if torMode == "always" {
-			return Dialers{}, errors.New("can't connect to Tor & --tor-mode=always set")
+	// defaults go last, so that all targets are covered
+	d.rules = append(d.rules, defaultRules(config.TorMode, config.Proxy != "")...)
+
+	if config.Proxy != "" {
+		p, err := NewProxy(config.Proxy, config.Timeout)
+		if err != nil {
+			return Dialers{}, errors.Wrap(err, "can't use --proxy")
 		}
 
-		Logger.Get().WithError(err).Debugln("--tor-mode=auto and not Tor connection available: falling back to Clearnet only")
+		d.Proxy = p
 	}
 
-	d.Tor = torDialer
+	d.tor = &lazyDialer{init: func() (proxy.Dialer, error) {
+		return getTor(config)
+	}}
+
+	d.i2p = &lazyDialer{init: func() (proxy.Dialer, error) {
+		if config.I2PSam == "" {
+			return nil, errors.New("--i2p-sam not set")
+		}
+
+		i2pDialer, err := i2p.NewDialer(config.I2PSam)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't use I2P")
+		}
+
+		i2pDialer.Timeout = config.Timeout
+
+		return i2pDialer, nil
+	}}
+
 	return
 }
 
+func getTor(config Config) (proxy.Dialer, error) {
+	torDialer, err := tor.GetWorkingTor(config.Tor)
+	if err == nil {
+		return torDialer, nil
+	}
+
+	if config.TorMode == "always" {
+		return nil, errors.Wrap(err, "--tor-mode=always set, but")
+	}
+
+	log := Logger.Get().WithError(err)
+
+	// something is there, but not usable: likely a misconfiguration worth mentioning
+	switch errors.Cause(err) {
+	case tor.ErrNotTor, tor.ErrNotBootstrapped:
+		log.Warnln("Tor unusable: falling back to Clearnet only")
+
+	default:
+		log.Debugln("--tor-mode=auto and not Tor connection available: falling back to Clearnet only")
+	}
+
+	// NOTE: nil *tor.Proxy must not end up in the interface, as it would no longer compare equal to nil
+	return nil, err
+}
+
 func GetCacheDir() string {
 	return path.Join(cacheBase, cacheDir)
 }
+
+// GetDataDir returns location for things that, unlike cache, shouldn't be lost, ex. keys
+func GetDataDir() string {
+	return path.Join(dataBase, cacheDir)
+}
@@ -2,4 +2,7 @@ package common
 
 import "os"
 
-var cacheBase = os.Getenv("HOME") + "/Library/Caches"
+var (
+	cacheBase = os.Getenv("HOME") + "/Library/Caches"
+	dataBase  = os.Getenv("HOME") + "/Library/Application Support"
+)
@@ -2,4 +2,7 @@ package common
 
 import "os"
 
-var cacheBase = os.Getenv("LOCALAPPDATA")
+var (
+	cacheBase = os.Getenv("LOCALAPPDATA")
+	dataBase  = os.Getenv("APPDATA")
+)
@@ -7,9 +7,14 @@ import (
 	"path/filepath"
 )
 
-var cacheBase string
+var cacheBase, dataBase string
 
 func init() {
+	dataBase = filepath.Join(os.Getenv("HOME"), ".local", "share")
+	if os.Getenv("XDG_DATA_HOME") != "" {
+		dataBase = os.Getenv("XDG_DATA_HOME")
+	}
+
 	if os.Getenv("XDG_CACHE_HOME") != "" {
 		cacheBase = os.Getenv("XDG_CACHE_HOME")
 		return
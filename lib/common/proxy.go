@@ -0,0 +1,108 @@
+package common
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// httpConnect tunnels connections through an HTTP proxy, using CONNECT method.  It implements proxy.Dialer.
+type httpConnect struct {
+	addr    string
+	auth    string
+	forward proxy.Dialer
+}
+
+// bufferedConn is a net.Conn, that first returns whatever was read past the proxy's response
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func init() {
+	proxy.RegisterDialerType("http", newHttpConnect)
+}
+
+func newHttpConnect(u *url.URL, forward proxy.Dialer) (proxy.Dialer, error) {
+	h := &httpConnect{
+		addr:    u.Host,
+		forward: forward,
+	}
+
+	if u.Port() == "" {
+		h.addr = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	if u.User != nil {
+		password, _ := u.User.Password()
+		h.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(u.User.Username()+":"+password))
+	}
+
+	return h, nil
+}
+
+// Dial sends CONNECT for addr.  It's bounded by deadline of connection to the proxy, if forward dialer sets one.
+func (h *httpConnect) Dial(network, addr string) (net.Conn, error) {
+	conn, err := h.forward.Dial("tcp", h.addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't connect to HTTP proxy")
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+
+	if h.auth != "" {
+		req.Header.Set("Proxy-Authorization", h.auth)
+	}
+
+	err = req.Write(conn)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "can't send CONNECT to HTTP proxy")
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		conn.Close()
+		return nil, errors.Wrap(err, "invalid HTTP proxy response")
+	}
+
+	// NOTE: body is not read, as after a successful CONNECT there's none, and otherwise connection is closed anyway
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, errors.Errorf("HTTP proxy refused to connect to %s: %s", addr, resp.Status)
+	}
+
+	return &bufferedConn{conn, r}, nil
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// NewProxy returns a dialer for proxy at rawUrl.  Supported are `socks5://` and `http://` (CONNECT), both with
+// optional `user:pass@`.
+func NewProxy(rawUrl string, timeout time.Duration) (proxy.Dialer, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy URL")
+	}
+
+	if u.Scheme != "socks5" && u.Scheme != "http" {
+		return nil, errors.Errorf("unsupported proxy type: %s (only socks5:// and http:// are)", u.Scheme)
+	}
+
+	return proxy.FromURL(u, deadline.Dialer{Timeout: timeout})
+}
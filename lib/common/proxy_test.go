@@ -0,0 +1,143 @@
+package common
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeHttpProxy is a minimal stand-in for an HTTP proxy, that only allows CONNECT with valid credentials
+type fakeHttpProxy struct {
+	listener net.Listener
+	auth     string
+	target   string
+}
+
+func newFakeHttpProxy(auth, target string) *fakeHttpProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	f := &fakeHttpProxy{l, auth, target}
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeHttpProxy) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeHttpProxy) Close() {
+	_ = f.listener.Close()
+}
+
+func (f *fakeHttpProxy) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil {
+				return
+			}
+
+			switch {
+			case req.Method != http.MethodConnect:
+				_, _ = io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+
+			case req.Header.Get("Proxy-Authorization") != f.auth:
+				_, _ = io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+
+			case req.Host != f.target:
+				_, _ = io.WriteString(conn, "HTTP/1.1 403 Forbidden\r\n\r\n")
+
+			default:
+				// greeting sent right after the response checks that nothing buffered is lost
+				_, _ = io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\nhello")
+				_, _ = io.Copy(conn, conn)
+			}
+		}(conn)
+	}
+}
+
+func TestHttpConnect(t *testing.T) {
+	// "user:pass"
+	f := newFakeHttpProxy("Basic dXNlcjpwYXNz", "example.com:8333")
+	defer f.Close()
+
+	Convey("Given an HTTP proxy with valid credentials", t, func() {
+		d, err := NewProxy("http://user:pass@"+f.Addr(), 0)
+		So(err, ShouldBeNil)
+
+		conn, err := d.Dial("tcp", "example.com:8333")
+		So(err, ShouldBeNil)
+		defer conn.Close()
+
+		Convey("data sent with the response should be kept", func() {
+			buf := make([]byte, 5)
+			_, err := io.ReadFull(conn, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, "hello")
+		})
+
+		Convey("tunnel should work both ways", func() {
+			_, _ = io.ReadFull(conn, make([]byte, 5))
+			_, _ = conn.Write([]byte("ping"))
+
+			buf := make([]byte, 4)
+			_, err := io.ReadFull(conn, buf)
+			So(err, ShouldBeNil)
+			So(string(buf), ShouldEqual, "ping")
+		})
+	})
+
+	Convey("Given an HTTP proxy w/o credentials", t, func() {
+		d, err := NewProxy("http://"+f.Addr(), 0)
+		So(err, ShouldBeNil)
+
+		_, err = d.Dial("tcp", "example.com:8333")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "407")
+	})
+
+	Convey("Given an HTTP proxy that never responds", t, func() {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer l.Close()
+
+		stalled := make(chan net.Conn, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err == nil {
+				stalled <- conn
+			}
+		}()
+
+		d, err := NewProxy("http://"+l.Addr().String(), 50*time.Millisecond)
+		So(err, ShouldBeNil)
+
+		start := time.Now()
+		_, err = d.Dial("tcp", "example.com:8333")
+		So(err, ShouldNotBeNil)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+
+		(<-stalled).Close()
+	})
+
+	Convey("Given an unsupported proxy type", t, func() {
+		_, err := NewProxy("https://"+f.Addr(), 0)
+		So(err, ShouldNotBeNil)
+	})
+}
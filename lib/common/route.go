@@ -0,0 +1,357 @@
+package common
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/tor"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// kinds of targets, that can be routed separately
+const (
+	KindClearnet = "clearnet"
+	KindOnion    = "onion"
+	KindI2P      = "i2p"
+	KindCJDNS    = "cjdns"
+	KindLocal    = "local"
+)
+
+// names of dialers targets can be routed to
+const (
+	DialerDirect = "direct"
+	DialerTor    = "tor"
+	DialerI2P    = "i2p"
+	DialerProxy  = "proxy"
+	DialerNone   = "none"
+)
+
+const ruleArrow = "->"
+
+var (
+	kinds       = []string{KindClearnet, KindOnion, KindI2P, KindCJDNS, KindLocal}
+	dialerNames = []string{DialerDirect, DialerTor, DialerI2P, DialerProxy, DialerNone}
+
+	types = map[string]int{
+		"ipv4":   connstring.TypeIpV4,
+		"ipv6":   connstring.TypeIpV6,
+		"domain": connstring.TypeDomain,
+		"onion":  connstring.TypeTorV3,
+		"i2p":    connstring.TypeI2P,
+		"cjdns":  connstring.TypeCJDNS,
+	}
+)
+
+type (
+	// Rule routes targets matching all of its conditions to the first available of its Dialers.  Rule w/o any
+	// conditions matches everything.
+	Rule struct {
+		Raw     string
+		Dialers []string
+
+		// set for rules implied by --tor-mode & --proxy
+		Default bool
+
+		kind             string
+		typ              int
+		cidr             *net.IPNet
+		suffix           string
+		portMin, portMax uint64
+	}
+
+	// Skipped is a dialer that was not used, despite a matching rule
+	Skipped struct {
+		Dialer string `json:"dialer"`
+		Reason string `json:"reason"`
+	}
+
+	// Route explains which dialer is used for a target, and why
+	Route struct {
+		Address string    `json:"address"`
+		Kind    string    `json:"kind"`
+		Rule    string    `json:"rule"`
+		Default bool      `json:"default_rule"`
+		Dialer  string    `json:"dialer,omitempty"`
+		Skipped []Skipped `json:"skipped,omitempty"`
+		Error   string    `json:"error,omitempty"`
+	}
+)
+
+// Kind returns kind of target c is, for routing purposes
+func Kind(c connstring.ConnString) string {
+	switch {
+	case c.IsTor():
+		return KindOnion
+
+	case c.IsI2P():
+		return KindI2P
+
+	case c.Type == connstring.TypeCJDNS:
+		return KindCJDNS
+
+	case c.Local:
+		return KindLocal
+	}
+
+	return KindClearnet
+}
+
+// ParseRule parses `[condition ...] -> dialer[,dialer ...]`.  Conditions are: a bare kind (ex. `clearnet`),
+// `type=ipv4|ipv6|domain|onion|i2p|cjdns`, `cidr=10.0.0.0/8`, `suffix=.example.com` & `port=8333` or
+// `port=18000-18999`.  Shorter `kind:dialer` form is also accepted.
+func ParseRule(raw string) (r Rule, err error) {
+	r.Raw = strings.TrimSpace(raw)
+
+	chunks := strings.Split(r.Raw, ruleArrow)
+	if len(chunks) == 1 {
+		// kind:dialer
+		chunks = strings.Split(r.Raw, ":")
+		if len(chunks) != 2 || !contains(kinds, chunks[0]) {
+			return r, errors.Errorf("invalid route %s: expected [condition ...] %s dialer[,dialer ...]", raw, ruleArrow)
+		}
+	}
+
+	if len(chunks) != 2 {
+		return r, errors.Errorf("invalid route %s: only one %s allowed", raw, ruleArrow)
+	}
+
+	for _, cond := range strings.Fields(chunks[0]) {
+		err = r.parseCondition(cond)
+		if err != nil {
+			return r, errors.Wrapf(err, "invalid route %s", raw)
+		}
+	}
+
+	for _, d := range strings.Split(chunks[1], ",") {
+		d = strings.TrimSpace(d)
+		if !contains(dialerNames, d) {
+			return r, errors.Errorf("invalid route %s: dialer has to be one of: %s", raw, strings.Join(dialerNames, ", "))
+		}
+
+		r.Dialers = append(r.Dialers, d)
+	}
+
+	return r, nil
+}
+
+func (r *Rule) parseCondition(cond string) (err error) {
+	if contains(kinds, cond) {
+		r.kind = cond
+		return nil
+	}
+
+	kv := strings.SplitN(cond, "=", 2)
+	if len(kv) != 2 {
+		return errors.Errorf("unknown condition %s: kind has to be one of: %s", cond, strings.Join(kinds, ", "))
+	}
+
+	key, value := kv[0], kv[1]
+	switch key {
+	case "type":
+		typ, ok := types[value]
+		if !ok {
+			return errors.Errorf("unknown address type: %s", value)
+		}
+
+		r.typ = typ
+
+	case "cidr":
+		_, r.cidr, err = net.ParseCIDR(value)
+		return err
+
+	case "suffix":
+		r.suffix = strings.ToLower(strings.TrimPrefix(value, "."))
+
+	case "port":
+		ports := strings.SplitN(value, "-", 2)
+		r.portMin, err = strconv.ParseUint(ports[0], 10, 16)
+		if err != nil {
+			return errors.Wrapf(err, "invalid port: %s", value)
+		}
+
+		r.portMax = r.portMin
+		if len(ports) == 2 {
+			r.portMax, err = strconv.ParseUint(ports[1], 10, 16)
+			if err != nil {
+				return errors.Wrapf(err, "invalid port: %s", value)
+			}
+		}
+
+		// NOTE: portMax of 0 means there's no port condition, so neither can be 0
+		if r.portMin == 0 || r.portMax < r.portMin {
+			return errors.Errorf("invalid port: %s", value)
+		}
+
+	default:
+		return errors.Errorf("unknown condition: %s", key)
+	}
+
+	return nil
+}
+
+// Matches is true if c meets all conditions of the rule.  `cidr=` only matches IPs, and domains resolved to IPs
+// all within the range.  `port=` only matches targets with port set explicitly.
+func (r Rule) Matches(c connstring.ConnString) bool {
+	if r.kind != "" && r.kind != Kind(c) {
+		return false
+	}
+
+	if r.typ != 0 && r.typ != c.Type {
+		return false
+	}
+
+	if r.suffix != "" && c.Host != r.suffix && !strings.HasSuffix(c.Host, "."+r.suffix) {
+		return false
+	}
+
+	if r.cidr != nil {
+		ips := c.Resolved
+		if c.IP != nil {
+			ips = []net.IP{c.IP}
+		}
+
+		if len(ips) == 0 {
+			return false
+		}
+
+		for _, ip := range ips {
+			if !r.cidr.Contains(ip) {
+				return false
+			}
+		}
+	}
+
+	if r.portMax != 0 {
+		port, err := strconv.ParseUint(c.Port, 10, 16)
+		if err != nil || port < r.portMin || port > r.portMax {
+			return false
+		}
+	}
+
+	return true
+}
+
+// defaultRules translate --tor-mode & --proxy into rules: local & CJDNS targets are dialled directly, and explicitly
+// set proxy is preferred over Tor in "auto" mode.  Rules always cover all kinds of targets.
+func defaultRules(torMode string, hasProxy bool) []Rule {
+	onion, clearnet := DialerTor, []string{DialerDirect}
+
+	switch torMode {
+	case "never":
+		onion = DialerNone
+
+	case "auto":
+		clearnet = []string{DialerTor, DialerDirect}
+
+	case "always":
+		clearnet = []string{DialerTor}
+	}
+
+	if hasProxy && torMode != "always" {
+		clearnet = []string{DialerProxy}
+	}
+
+	rules := []Rule{
+		{kind: KindLocal, Dialers: []string{DialerDirect}},
+		{kind: KindCJDNS, Dialers: []string{DialerDirect}},
+		{kind: KindI2P, Dialers: []string{DialerI2P}},
+		{kind: KindOnion, Dialers: []string{onion}},
+		{kind: KindClearnet, Dialers: clearnet},
+	}
+
+	for i := range rules {
+		rules[i].Default = true
+		rules[i].Raw = fmt.Sprintf("%s %s %s", rules[i].kind, ruleArrow, strings.Join(rules[i].Dialers, ","))
+	}
+
+	return rules
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (d Dialers) named(name, kind string) (proxy.Dialer, error) {
+	switch name {
+	case DialerDirect:
+		return d.ClearNet, nil
+
+	case DialerTor:
+		return d.Tor()
+
+	case DialerI2P:
+		dialer, err := d.I2P()
+		if err != nil {
+			return nil, errors.Wrapf(err, "can't check %s addresses", kind)
+		}
+
+		return dialer, nil
+
+	case DialerProxy:
+		if d.Proxy == nil {
+			return nil, errors.Errorf("can't check %s addresses w/o --proxy set", kind)
+		}
+
+		return d.Proxy, nil
+	}
+
+	return nil, errors.Errorf("checking %s addresses is disabled (see --tor-mode & --route)", kind)
+}
+
+// Explain returns which dialer would be used for c, and why.  Dialers that are unavailable are skipped in favour of
+// the next one in a rule.  Note that it might need to verify Tor, or create I2P session to tell.
+func (d Dialers) Explain(c connstring.ConnString) (r Route, dialer proxy.Dialer) {
+	r = Route{
+		Address: c.Raw,
+		Kind:    Kind(c),
+	}
+
+	for _, rule := range d.rules {
+		if !rule.Matches(c) {
+			continue
+		}
+
+		r.Rule, r.Default = rule.Raw, rule.Default
+
+		for _, name := range rule.Dialers {
+			var err error
+			dialer, err = d.named(name, r.Kind)
+			if err == nil {
+				r.Dialer, r.Error = name, ""
+				return
+			}
+
+			r.Skipped = append(r.Skipped, Skipped{name, err.Error()})
+			r.Error = err.Error()
+		}
+
+		return
+	}
+
+	r.Error = "no matching route"
+	return
+}
+
+// For returns a dialer to be used for all connections to c.  If it's Tor, it's isolated as configured.
+func (d Dialers) For(c connstring.ConnString) (proxy.Dialer, error) {
+	r, dialer := d.Explain(c)
+	if dialer == nil {
+		return nil, errors.New(r.Error)
+	}
+
+	if p, ok := dialer.(*tor.Proxy); ok {
+		return p.For(c.Host), nil
+	}
+
+	return dialer, nil
+}
@@ -0,0 +1,158 @@
+package connstring
+
+import (
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Class describes what part of the address space an address belongs to
+type Class int
+
+const (
+	// ClassUnknown is used for domains that haven't been resolved, and for overlay networks (Tor & I2P)
+	ClassUnknown Class = iota
+	ClassRoutable
+	ClassUnspecified
+	ClassLoopback
+	ClassPrivate
+	ClassLinkLocal
+	ClassCGNAT
+	ClassDocumentation
+	ClassMulticast
+	ClassReserved
+)
+
+var classNames = map[Class]string{
+	ClassUnknown:       "unknown",
+	ClassRoutable:      "routable",
+	ClassUnspecified:   "unspecified",
+	ClassLoopback:      "loopback",
+	ClassPrivate:       "private",
+	ClassLinkLocal:     "link-local",
+	ClassCGNAT:         "cgnat",
+	ClassDocumentation: "documentation",
+	ClassMulticast:     "multicast",
+	ClassReserved:      "reserved",
+}
+
+type classRange struct {
+	block *net.IPNet
+	class Class
+}
+
+// NOTE: IPv4-mapped IPv6 addresses (::ffff:0:0/96) are classified as the IPv4 address they contain
+var classRanges = []classRange{
+	{mustParseCIDR("0.0.0.0/8"), ClassUnspecified},         // RFC1122 "this network"
+	{mustParseCIDR("::/128"), ClassUnspecified},            //
+	{mustParseCIDR("127.0.0.0/8"), ClassLoopback},          // RFC1122
+	{mustParseCIDR("::1/128"), ClassLoopback},              // RFC4291
+	{mustParseCIDR("10.0.0.0/8"), ClassPrivate},            // RFC1918
+	{mustParseCIDR("172.16.0.0/12"), ClassPrivate},         // RFC1918
+	{mustParseCIDR("192.168.0.0/16"), ClassPrivate},        // RFC1918
+	{mustParseCIDR("fc00::/7"), ClassPrivate},              // RFC4193 ULA, incl. CJDNS
+	{mustParseCIDR("169.254.0.0/16"), ClassLinkLocal},      // RFC3927
+	{mustParseCIDR("fe80::/10"), ClassLinkLocal},           // RFC4291
+	{mustParseCIDR("100.64.0.0/10"), ClassCGNAT},           // RFC6598
+	{mustParseCIDR("192.0.2.0/24"), ClassDocumentation},    // RFC5737 TEST-NET-1
+	{mustParseCIDR("198.51.100.0/24"), ClassDocumentation}, // RFC5737 TEST-NET-2
+	{mustParseCIDR("203.0.113.0/24"), ClassDocumentation},  // RFC5737 TEST-NET-3
+	{mustParseCIDR("2001:db8::/32"), ClassDocumentation},   // RFC3849
+	{mustParseCIDR("224.0.0.0/4"), ClassMulticast},         // RFC5771
+	{mustParseCIDR("ff00::/8"), ClassMulticast},            // RFC4291
+	{mustParseCIDR("240.0.0.0/4"), ClassReserved},          // RFC1112, incl. broadcast
+}
+
+// Classify returns Class of an IP
+func Classify(ip net.IP) Class {
+	if ip == nil {
+		return ClassUnknown
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+
+	for _, r := range classRanges {
+		if r.block.Contains(ip) {
+			return r.class
+		}
+	}
+
+	return ClassRoutable
+}
+
+func (c Class) String() string {
+	return classNames[c]
+}
+
+func (c Class) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// IsLocal is true for addresses that can only be reached directly, and never through Tor
+func (c Class) IsLocal() bool {
+	switch c {
+	case ClassUnspecified, ClassLoopback, ClassPrivate, ClassLinkLocal, ClassCGNAT:
+		return true
+	}
+
+	return false
+}
+
+// classifyDomain recognizes names that never leave local machine, or network, see RFC6761 & RFC6762
+func classifyDomain(host string) Class {
+	host = strings.TrimSuffix(host, ".")
+
+	if host == localhost || strings.HasSuffix(host, "."+localhost) {
+		return ClassLoopback
+	}
+
+	if strings.HasSuffix(host, localTld) {
+		return ClassLinkLocal
+	}
+
+	return ClassUnknown
+}
+
+// Resolve looks up IPs of a domain, and updates Class & Local accordingly: domain is only local if all its IPs are.
+// If lookup is nil, the system resolver is used, which means the name is sent to the configured DNS server, even
+// if the connection itself is later made over Tor.  Does nothing for connstrings other than domains.
+func (c *ConnString) Resolve(lookup func(host string) ([]net.IP, error)) error {
+	if c.Type != TypeDomain {
+		return nil
+	}
+
+	if lookup == nil {
+		lookup = net.LookupIP
+	}
+
+	ips, err := lookup(c.Host)
+	if err != nil {
+		return errors.Wrapf(err, "can't resolve %s", c.Host)
+	}
+
+	if len(ips) == 0 {
+		return errors.Errorf("%s has no IP addresses", c.Host)
+	}
+
+	c.Resolved = ips
+
+	local := true
+	for _, ip := range ips {
+		if !Classify(ip).IsLocal() {
+			local = false
+		}
+	}
+
+	// NOTE: with mixed results, Class is of the first IP that agrees with Local
+	for _, ip := range ips {
+		if class := Classify(ip); class.IsLocal() == local {
+			c.Class, c.Local = class, local
+			break
+		}
+	}
+
+	return nil
+}
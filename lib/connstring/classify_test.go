@@ -0,0 +1,130 @@
+package connstring
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestClassify(t *testing.T) {
+	Convey("Given IPs from all ranges", t, func() {
+		for ip, class := range map[string]Class{
+			"0.1.2.3":              ClassUnspecified,
+			"::":                   ClassUnspecified,
+			"127.0.0.53":           ClassLoopback,
+			"::1":                  ClassLoopback,
+			"::ffff:127.0.0.1":     ClassLoopback,
+			"10.1.2.3":             ClassPrivate,
+			"172.31.255.255":       ClassPrivate,
+			"192.168.1.100":        ClassPrivate,
+			"::ffff:10.0.0.1":      ClassPrivate,
+			"fd00::1":              ClassPrivate,
+			cjdnsNoPort:            ClassPrivate,
+			"169.254.169.254":      ClassLinkLocal,
+			localIpV6NoPort:        ClassLinkLocal,
+			"100.64.0.1":           ClassCGNAT,
+			"100.127.255.254":      ClassCGNAT,
+			"192.0.2.1":            ClassDocumentation,
+			"2001:db8::1":          ClassDocumentation,
+			"239.255.255.250":      ClassMulticast,
+			"ff02::1":              ClassMulticast,
+			"255.255.255.255":      ClassReserved,
+			"100.128.0.1":          ClassRoutable,
+			"172.32.0.1":           ClassRoutable,
+			ipV4NoPort:             ClassRoutable,
+			ipV6NoPort:             ClassRoutable,
+			"::ffff:" + ipV4NoPort: ClassRoutable,
+		} {
+			So(Classify(net.ParseIP(ip)).String(), ShouldEqual, class.String())
+		}
+	})
+
+	Convey("Given local-only domains", t, func() {
+		for host, local := range map[string]bool{
+			"localhost":              true,
+			"bitcoind.localhost":     true,
+			"node.local":             true,
+			"node.local.":            true,
+			"evil.localhost.example": false,
+			"local.example.com":      false,
+			"example.localnet":       false,
+		} {
+			c, err := Parse(host)
+			So(err, ShouldBeNil)
+			So(c.Local, ShouldEqual, local)
+		}
+	})
+
+	Convey("Given an IPv4-mapped IPv6 address", t, func() {
+		c, err := Parse("[::ffff:192.168.1.1]:8333")
+		So(err, ShouldBeNil)
+		So(c.Local, ShouldBeTrue)
+		So(c.Class, ShouldEqual, ClassPrivate)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	lookup := func(ips ...string) func(string) ([]net.IP, error) {
+		return func(string) (res []net.IP, _ error) {
+			for _, ip := range ips {
+				res = append(res, net.ParseIP(ip))
+			}
+
+			return
+		}
+	}
+
+	Convey("Given a domain pointing to a private IP", t, func() {
+		c, _ := Parse("node.example.com")
+		So(c.Local, ShouldBeFalse)
+
+		So(c.Resolve(lookup("10.0.0.5")), ShouldBeNil)
+		So(c.Local, ShouldBeTrue)
+		So(c.Class, ShouldEqual, ClassPrivate)
+		So(c.Resolved, ShouldHaveLength, 1)
+	})
+
+	Convey("Given a domain with both private & public IPs", t, func() {
+		c, _ := Parse("node.example.com")
+
+		So(c.Resolve(lookup("10.0.0.5", ipV4NoPort)), ShouldBeNil)
+		So(c.Local, ShouldBeFalse)
+		So(c.Class, ShouldEqual, ClassRoutable)
+	})
+
+	Convey("Given a domain that fails to resolve", t, func() {
+		c, _ := Parse("node.example.com")
+
+		err := c.Resolve(func(string) ([]net.IP, error) { return nil, errors.New("NXDOMAIN") })
+		So(err, ShouldNotBeNil)
+		So(c.Class, ShouldEqual, ClassUnknown)
+	})
+
+	Convey("Given a resolved domain", t, func() {
+		c, _ := Parse(pubkey + "@node.example.com:" + port)
+		So(c.Resolve(lookup(ipV6NoPort, localIpV4NoPort)), ShouldBeNil)
+
+		Convey("each IP should become its own connstring", func() {
+			v6, v4 := c.ForIP(c.Resolved[0]), c.ForIP(c.Resolved[1])
+
+			So(v6.Type, ShouldEqual, TypeIpV6)
+			So(v6.Raw, ShouldEqual, pubkey+"@"+ipV6WithPort)
+			So(v6.Local, ShouldBeFalse)
+
+			So(v4.Type, ShouldEqual, TypeIpV4)
+			So(v4.ToString(), ShouldEqual, pubkey+"@"+localIpV4WithPort)
+			So(v4.Local, ShouldBeTrue)
+			So(v4.Resolved, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given an IP", t, func() {
+		c, _ := Parse(ipV4NoPort)
+
+		So(c.Resolve(lookup("10.0.0.5")), ShouldBeNil)
+		So(c.Resolved, ShouldBeEmpty)
+		So(c.Local, ShouldBeFalse)
+	})
+}
@@ -0,0 +1,209 @@
+package connstring
+
+import (
+	"math/big"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultExpandLimit is a safety cap on how many targets a single run can expand into
+const DefaultExpandLimit = 1024
+
+// Expand turns ranges into individual connstrings.  Supported are CIDRs (`192.168.1.0/24:8333`), IP ranges
+// (`10.0.0.5-10.0.0.40`) and port ranges (`host:8333-8340`), or any combination of host & port range.  Inputs
+// w/o ranges are returned as-is.  limit is the maximum number of connstrings a range can expand into, and doesn't
+// apply to inputs w/o ranges.
+func Expand(input string, limit int) ([]string, error) {
+	prefix, hostPart, portPart := splitRange(input)
+
+	ports, err := expandPorts(portPart)
+	if err != nil {
+		return nil, err
+	}
+
+	hosts, err := expandHosts(hostPart, limit/len(ports))
+	if err != nil {
+		return nil, err
+	}
+
+	// nothing to expand: keep the original, so that Raw is preserved
+	if hosts[0] == hostPart && len(ports) == 1 {
+		return []string{input}, nil
+	}
+
+	if len(hosts)*len(ports) > limit {
+		return nil, errors.Errorf("%s expands to more than %d targets", Redact(input), limit)
+	}
+
+	var out []string
+	for _, host := range hosts {
+		for _, port := range ports {
+			connstring := host
+			if port != "" {
+				connstring = net.JoinHostPort(host, port)
+			}
+
+			out = append(out, prefix+connstring)
+		}
+	}
+
+	return out, nil
+}
+
+// splitRange splits input into scheme & LN pubkey prefix (incl. `://` & `@`), host and port parts.  Unlike
+// net.SplitHostPort it's ok with `/` and `-` in either part.
+func splitRange(input string) (prefix, host, port string) {
+	if i := strings.Index(input, schemeSeparator); i != -1 {
+		prefix, input = input[:i+len(schemeSeparator)], input[i+len(schemeSeparator):]
+	}
+
+	if i := strings.LastIndex(input, "@"); i != -1 {
+		prefix, input = prefix+input[:i+1], input[i+1:]
+	}
+
+	// [IPv6]:port or [IPv6/prefix]:port
+	if strings.HasPrefix(input, "[") {
+		end := strings.Index(input, "]")
+		if end != -1 {
+			return prefix, input[1:end], strings.TrimPrefix(input[end+1:], ":")
+		}
+	}
+
+	// bare IPv6 can't have a port
+	if strings.Count(input, ":") != 1 {
+		return prefix, input, ""
+	}
+
+	i := strings.Index(input, ":")
+	return prefix, input[:i], input[i+1:]
+}
+
+func expandPorts(port string) ([]string, error) {
+	chunks := strings.Split(port, "-")
+	if len(chunks) == 1 {
+		return []string{port}, nil
+	}
+
+	if len(chunks) != 2 {
+		return nil, errors.Errorf("invalid port range: %s", port)
+	}
+
+	from, err := strconv.ParseUint(chunks[0], 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid port range start: %s", chunks[0])
+	}
+
+	to, err := strconv.ParseUint(chunks[1], 10, 16)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid port range end: %s", chunks[1])
+	}
+
+	if from > to {
+		return nil, errors.Errorf("port range is reversed: %s", port)
+	}
+
+	var ports []string
+	for p := from; p <= to; p++ {
+		ports = append(ports, strconv.FormatUint(p, 10))
+	}
+
+	return ports, nil
+}
+
+func expandHosts(host string, limit int) ([]string, error) {
+	if strings.Contains(host, "/") {
+		return expandCidr(host, limit)
+	}
+
+	// domains can contain `-` too, so it's only a range if both ends are IPs
+	chunks := strings.Split(host, "-")
+	if len(chunks) == 2 {
+		from, to := net.ParseIP(chunks[0]), net.ParseIP(chunks[1])
+		if from != nil && to != nil {
+			return expandIpRange(from, to, limit)
+		}
+	}
+
+	return []string{host}, nil
+}
+
+func expandCidr(cidr string, limit int) ([]string, error) {
+	_, block, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CIDR: %s", cidr)
+	}
+
+	ones, bits := block.Mask.Size()
+
+	// NOTE: network & broadcast addresses are skipped for IPv4, unless there's nothing else (/31 & /32)
+	from, to := block.IP, lastIp(block)
+	if bits == 8*net.IPv4len && bits-ones > 1 {
+		from, to = nextIp(from), prevIp(to)
+	}
+
+	return expandIpRange(from, to, limit)
+}
+
+func expandIpRange(from, to net.IP, limit int) ([]string, error) {
+	if (from.To4() == nil) != (to.To4() == nil) {
+		return nil, errors.New("IP range can't mix IPv4 & IPv6")
+	}
+
+	if from.To4() != nil {
+		from, to = from.To4(), to.To4()
+	}
+
+	size := new(big.Int).Sub(new(big.Int).SetBytes(to), new(big.Int).SetBytes(from))
+	if size.Sign() < 0 {
+		return nil, errors.Errorf("IP range is reversed: %s-%s", from, to)
+	}
+
+	if size.Cmp(big.NewInt(int64(limit))) >= 0 {
+		return nil, errors.Errorf("IP range %s-%s has more than %d addresses", from, to, limit)
+	}
+
+	var ips []string
+	for ip := from; ; ip = nextIp(ip) {
+		ips = append(ips, ip.String())
+
+		if ip.Equal(to) {
+			return ips, nil
+		}
+	}
+}
+
+func lastIp(block *net.IPNet) net.IP {
+	ip := make(net.IP, len(block.IP))
+	for i := range ip {
+		ip[i] = block.IP[i] | ^block.Mask[i]
+	}
+
+	return ip
+}
+
+func nextIp(ip net.IP) net.IP {
+	next := append(net.IP{}, ip...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+
+	return next
+}
+
+func prevIp(ip net.IP) net.IP {
+	prev := append(net.IP{}, ip...)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+
+	return prev
+}
@@ -0,0 +1,98 @@
+package connstring
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestExpand(t *testing.T) {
+	Convey("Given an input w/o ranges", t, func() {
+		for _, input := range []string{ipV4WithPort, ipV6WithPort, ipV6NoPort, "my-node.example.com:8333", lnTorV3WithPort} {
+			out, err := Expand(input, DefaultExpandLimit)
+
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []string{input})
+		}
+
+		Convey("limit should not apply", func() {
+			out, err := Expand(ipV4WithPort, 0)
+
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []string{ipV4WithPort})
+		})
+	})
+
+	Convey("Given an IPv4 CIDR with a port", t, func() {
+		out, err := Expand("192.168.1.0/30:8333", DefaultExpandLimit)
+
+		Convey("network & broadcast addresses should be skipped", func() {
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []string{"192.168.1.1:8333", "192.168.1.2:8333"})
+		})
+	})
+
+	Convey("Given a /24", t, func() {
+		out, err := Expand("10.0.0.0/24", DefaultExpandLimit)
+
+		So(err, ShouldBeNil)
+		So(out, ShouldHaveLength, 254)
+		So(out[0], ShouldEqual, "10.0.0.1")
+		So(out[253], ShouldEqual, "10.0.0.254")
+	})
+
+	Convey("Given an IPv6 CIDR with a port", t, func() {
+		out, err := Expand("[fd00::/126]:18444", DefaultExpandLimit)
+
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []string{"[fd00::]:18444", "[fd00::1]:18444", "[fd00::2]:18444", "[fd00::3]:18444"})
+	})
+
+	Convey("Given an IP range crossing an octet", t, func() {
+		out, err := Expand("10.0.0.254-10.0.1.1", DefaultExpandLimit)
+
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []string{"10.0.0.254", "10.0.0.255", "10.0.1.0", "10.0.1.1"})
+	})
+
+	Convey("Given a port range", t, func() {
+		out, err := Expand("localhost:18443-18445", DefaultExpandLimit)
+
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []string{"localhost:18443", "localhost:18444", "localhost:18445"})
+	})
+
+	Convey("Given a port range with a scheme", t, func() {
+		out, err := Expand("electrum://localhost:50001-50002", DefaultExpandLimit)
+
+		So(err, ShouldBeNil)
+		So(out, ShouldResemble, []string{"electrum://localhost:50001", "electrum://localhost:50002"})
+	})
+
+	Convey("Given both IP & port ranges", t, func() {
+		out, err := Expand("10.0.0.1-10.0.0.2:8333-8334", DefaultExpandLimit)
+
+		Convey("ports should vary first", func() {
+			So(err, ShouldBeNil)
+			So(out, ShouldResemble, []string{"10.0.0.1:8333", "10.0.0.1:8334", "10.0.0.2:8333", "10.0.0.2:8334"})
+		})
+	})
+
+	Convey("Given ranges exceeding the limit", t, func() {
+		_, err := Expand("10.0.0.0/8", DefaultExpandLimit)
+		So(err, ShouldNotBeNil)
+
+		_, err = Expand("[fd00::/64]:8333", DefaultExpandLimit)
+		So(err, ShouldNotBeNil)
+
+		_, err = Expand("10.0.0.0/24:8333-8340", 1000)
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given invalid ranges", t, func() {
+		for _, input := range []string{"10.0.0.9-10.0.0.1", "10.0.0.1-fd00::1", "host:8340-8333", "host:1-2-3", "10.0.0.0/33"} {
+			_, err := Expand(input, DefaultExpandLimit)
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
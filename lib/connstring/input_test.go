@@ -0,0 +1,159 @@
+package connstring
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// peersDat builds a minimal `peers.dat` with all addresses in the new table
+func peersDat(format byte, addrs ...[]byte) []byte {
+	var b bytes.Buffer
+	b.Write(peersDatMagics[0])
+	b.WriteByte(format)
+	b.WriteByte(32)
+	b.Write(make([]byte, peersDatKeyLen))
+	_ = binary.Write(&b, binary.LittleEndian, []int32{int32(len(addrs)), 0, 1024 ^ (1 << 30)})
+
+	for _, a := range addrs {
+		b.Write(a)
+	}
+
+	return b.Bytes()
+}
+
+// addrInfo encodes a single `peers.dat` entry, with source set to the address itself
+func addrInfo(v2 bool, netAddr []byte, port uint16) []byte {
+	var b bytes.Buffer
+
+	version, services := uint32(220000), []byte{1, 0, 0, 0, 0, 0, 0, 0}
+	if v2 {
+		version |= peersDatAddrV2Flag
+		services = []byte{1}
+	}
+
+	_ = binary.Write(&b, binary.LittleEndian, []uint32{version, 1700000000})
+	b.Write(services)
+	b.Write(netAddr)
+	_ = binary.Write(&b, binary.BigEndian, port)
+	b.Write(netAddr)
+	b.Write(make([]byte, 8+4))
+
+	return b.Bytes()
+}
+
+func TestParseInput(t *testing.T) {
+	Convey("Given bitcoin.conf lines", t, func() {
+		inputs, err := ParseInput([]byte(`
+# my nodes
+[main]
+addnode=` + ipV4WithPort + `
+connect=0
+test.seednode = ` + torV3NoPort + ` # over Tor
+rpcuser=satoshi
+externalip=` + ipV6WithPort + `
+`))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{
+			{ipV4WithPort, "addnode=" + ipV4WithPort},
+			{torV3NoPort, "test.seednode = " + torV3NoPort + " # over Tor"},
+			{ipV6WithPort, "externalip=" + ipV6WithPort},
+		})
+	})
+
+	Convey("Given plain, and quoted lines", t, func() {
+		inputs, err := ParseInput([]byte(lnTorV3WithPort + "\n \"" + ipV4NoPort + "\" \n\n"))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{
+			{lnTorV3WithPort, lnTorV3WithPort},
+			{ipV4NoPort, `"` + ipV4NoPort + `"`},
+		})
+	})
+
+	Convey("Given lines with `#` in passwords", t, func() {
+		inputs, err := ParseInput([]byte("rpc://user:pa#ss@" + ipV4NoPort + "\nrpc://user:pass@" + ipV4NoPort + "\t# local\n"))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{
+			{"rpc://user:pa#ss@" + ipV4NoPort, "rpc://user:pa#ss@" + ipV4NoPort},
+			{"rpc://user:pass@" + ipV4NoPort, "rpc://user:pass@" + ipV4NoPort + "\t# local"},
+		})
+	})
+
+	Convey("Given addresses containing `=`", t, func() {
+		inputs, err := ParseInput([]byte("rpc://u:cGFzcw==@" + ipV4WithPort + "\naddnode=" + ipV4NoPort + "\n"))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{
+			{"rpc://u:cGFzcw==@" + ipV4WithPort, "rpc://u:cGFzcw==@" + ipV4WithPort},
+			{ipV4NoPort, "addnode=" + ipV4NoPort},
+		})
+	})
+
+	Convey("Given lnd getinfo output", t, func() {
+		inputs, err := ParseInput([]byte(`{"identity_pubkey": "` + pubkey + `", "uris": ["` + lnTorV3WithPort + `"]}`))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{{lnTorV3WithPort, lnTorV3WithPort}})
+	})
+
+	Convey("Given getnodeaddresses output", t, func() {
+		inputs, err := ParseInput([]byte(`[
+  {"time": 1700000000, "services": 1033, "address": "` + ipV6NoPort + `", "port": 8333, "network": "ipv6"},
+  {"time": 1700000000, "services": 1033, "address": "` + i2pNoPort + `", "port": 0, "network": "i2p"}
+]`))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldHaveLength, 2)
+		So(inputs[0].Address, ShouldEqual, ipV6WithPort)
+		So(inputs[0].Raw, ShouldStartWith, `{"time":1700000000,`)
+		So(inputs[1].Address, ShouldEqual, i2pNoPort)
+	})
+
+	Convey("Given a JSON array of strings", t, func() {
+		inputs, err := ParseInput([]byte(`["` + ipV4WithPort + `"]`))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{{ipV4WithPort, ipV4WithPort}})
+	})
+
+	Convey("Given invalid JSON", t, func() {
+		_, err := ParseInput([]byte(`[{"foo": 1}]`))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given an addrv2 peers.dat", t, func() {
+		torPubKey, _ := hex.DecodeString(torV3PubKey)
+		i2pHash, _ := b32.DecodeString("H3R6BKN46QXFTWJA53PXIYKNTEGFYFJQTNZBM6IV6R5MUNGMQGMQ")
+
+		inputs, err := ParseInput(peersDat(4,
+			addrInfo(true, []byte{bip155IPv4, 4, 112, 108, 141, 146}, 8333),
+			addrInfo(true, append([]byte{bip155TorV3, 32}, torPubKey...), 8333),
+			addrInfo(true, append([]byte{bip155I2P, 32}, i2pHash...), 0),
+			addrInfo(true, []byte{bip155TorV2, 10, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, 8333),
+		))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{
+			{ipV4WithPort, "peers.dat new #0"},
+			{torV3WithPort, "peers.dat new #1"},
+			{i2pWithPort, "peers.dat new #2"},
+		})
+	})
+
+	Convey("Given a legacy peers.dat", t, func() {
+		ipv4 := append(make([]byte, 10), 0xff, 0xff, 112, 108, 141, 146)
+		onionCat := append(append([]byte{}, onionCatPrefix...), make([]byte, 10)...)
+
+		inputs, err := ParseInput(peersDat(1,
+			addrInfo(false, ipv4, 8333),
+			addrInfo(false, onionCat, 8333),
+		))
+		So(err, ShouldBeNil)
+		So(inputs, ShouldResemble, []Input{{ipV4WithPort, "peers.dat new #0"}})
+	})
+
+	Convey("Given a truncated peers.dat", t, func() {
+		raw := peersDat(4, addrInfo(true, []byte{bip155IPv4, 4, 112, 108, 141, 146}, 8333))
+
+		_, err := ParseInput(raw[:len(raw)-3])
+		So(err, ShouldNotBeNil)
+	})
+}
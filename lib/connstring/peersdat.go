@@ -0,0 +1,257 @@
+package connstring
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Bitcoin Core's `peers.dat` layout, see: https://github.com/bitcoin/bitcoin/blob/master/src/addrman.cpp
+const (
+	peersDatKeyLen = 32
+
+	// files in this, or newer formats use BIP155 (addrv2) encoding for addresses
+	peersDatFormatAddrV2 = 3
+
+	// set in address' own version, if it's addrv2-encoded
+	peersDatAddrV2Flag = 1 << 29
+
+	// BIP155 network IDs
+	bip155IPv4  = 1
+	bip155IPv6  = 2
+	bip155TorV2 = 3
+	bip155TorV3 = 4
+	bip155I2P   = 5
+	bip155CJDNS = 6
+
+	// the biggest address defined by BIP155
+	bip155MaxLen = 512
+)
+
+// message start bytes of mainnet, testnet3, testnet4, signet & regtest
+var peersDatMagics = [][]byte{
+	{0xf9, 0xbe, 0xb4, 0xd9},
+	{0x0b, 0x11, 0x09, 0x07},
+	{0x1c, 0x16, 0x3f, 0x28},
+	{0x0a, 0x03, 0xcf, 0x40},
+	{0xfa, 0xbf, 0xb5, 0xda},
+}
+
+// Tor v2 addresses are stored in v1 encoding as IPv6 w/in OnionCat range, and Core's internal ones in its own range
+var (
+	onionCatPrefix = []byte{0xfd, 0x87, 0xd8, 0x7e, 0xeb, 0x43}
+	internalPrefix = []byte{0xfd, 0x6b, 0x88, 0xc0, 0x87, 0x24}
+)
+
+var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+type peersDatReader struct {
+	r *bufio.Reader
+}
+
+func isPeersDat(raw []byte) bool {
+	if len(raw) < len(peersDatMagics[0])+2+peersDatKeyLen {
+		return false
+	}
+
+	for _, magic := range peersDatMagics {
+		if bytes.HasPrefix(raw, magic) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parsePeersDat extracts addresses from both new & tried tables of `peers.dat`.  Tor v2 & Core's internal
+// addresses are skipped.
+func parsePeersDat(raw []byte) (inputs []Input, err error) {
+	p := peersDatReader{bufio.NewReader(bytes.NewReader(raw))}
+
+	var header struct {
+		Magic       [4]byte
+		Format      uint8
+		Compat      uint8
+		Key         [peersDatKeyLen]byte
+		New, Tried  int32
+		BucketCount int32 // XOR-ed with 1<<30
+	}
+
+	err = binary.Read(p.r, binary.LittleEndian, &header)
+	if err != nil {
+		return nil, errors.Wrap(err, "truncated peers.dat header")
+	}
+
+	if header.New < 0 || header.Tried < 0 {
+		return nil, errors.Errorf("invalid peers.dat address count: %d new, %d tried", header.New, header.Tried)
+	}
+
+	tables := []struct {
+		name  string
+		count int32
+	}{
+		{"new", header.New},
+		{"tried", header.Tried},
+	}
+
+	for _, table := range tables {
+		for i := int32(0); i < table.count; i++ {
+			address, err := p.addrInfo(header.Format >= peersDatFormatAddrV2)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid peers.dat %s address #%d", table.name, i)
+			}
+
+			if address == "" {
+				continue
+			}
+
+			inputs = append(inputs, Input{address, fmt.Sprintf("peers.dat %s #%d", table.name, i)})
+		}
+	}
+
+	return inputs, nil
+}
+
+// addrInfo reads a single address entry, and returns it formatted as connstring, or empty string if unsupported
+func (p peersDatReader) addrInfo(v2 bool) (string, error) {
+	var version, timestamp uint32
+	err := binary.Read(p.r, binary.LittleEndian, &version)
+	if err != nil {
+		return "", err
+	}
+
+	err = binary.Read(p.r, binary.LittleEndian, &timestamp)
+	if err != nil {
+		return "", err
+	}
+
+	addrV2 := version&peersDatAddrV2Flag != 0
+	if addrV2 {
+		_, err = p.compactSize()
+	} else {
+		_, err = p.next(8) // services
+	}
+	if err != nil {
+		return "", err
+	}
+
+	host, err := p.netAddr(addrV2)
+	if err != nil {
+		return "", err
+	}
+
+	var port uint16
+	err = binary.Read(p.r, binary.BigEndian, &port)
+	if err != nil {
+		return "", err
+	}
+
+	// source address, last success (int64), and number of attempts (int32)
+	_, err = p.netAddr(v2)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = p.next(8 + 4)
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		return "", nil
+	}
+
+	return joinHostPort(host, strconv.Itoa(int(port))), nil
+}
+
+func (p peersDatReader) netAddr(v2 bool) (string, error) {
+	if !v2 {
+		ip, err := p.next(net.IPv6len)
+		if err != nil {
+			return "", err
+		}
+
+		if bytes.HasPrefix(ip, onionCatPrefix) || bytes.HasPrefix(ip, internalPrefix) {
+			return "", nil
+		}
+
+		return net.IP(ip).String(), nil
+	}
+
+	network, err := p.r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+
+	size, err := p.compactSize()
+	if err != nil {
+		return "", err
+	}
+
+	if size > bip155MaxLen {
+		return "", errors.Errorf("address too long: %d bytes", size)
+	}
+
+	addr, err := p.next(int(size))
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case network == bip155IPv4 && size == net.IPv4len,
+		network == bip155IPv6 && size == net.IPv6len,
+		network == bip155CJDNS && size == net.IPv6len:
+		return net.IP(addr).String(), nil
+
+	case network == bip155TorV3 && size == 32:
+		b := append(append(append([]byte{}, addr...), onionChecksum(addr, torV3Version)...), torV3Version)
+		return strings.ToLower(b32.EncodeToString(b)) + onionTld, nil
+
+	case network == bip155I2P && size == 32:
+		return strings.ToLower(b32.EncodeToString(addr)) + i2pB32Tld, nil
+	}
+
+	// Tor v2, or networks unknown at the time of writing
+	return "", nil
+}
+
+func (p peersDatReader) compactSize() (uint64, error) {
+	first, err := p.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	switch first {
+	case 0xfd:
+		n = 2
+	case 0xfe:
+		n = 4
+	case 0xff:
+		n = 8
+	default:
+		return uint64(first), nil
+	}
+
+	b, err := p.next(n)
+	if err != nil {
+		return 0, err
+	}
+
+	return binary.LittleEndian.Uint64(append(b, make([]byte, 8-n)...)), nil
+}
+
+// next reads, and returns next n bytes
+func (p peersDatReader) next(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := io.ReadFull(p.r, b)
+	return b, err
+}
@@ -0,0 +1,47 @@
+// Package deadline bounds how long connecting can take, including handshakes of proxies, as dialers of
+// golang.org/x/net/proxy can't be cancelled
+package deadline
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// Dialer connects directly, and sets a deadline of Timeout on each connection.  Used as a forward dialer of a proxy, it
+// bounds proxy's handshake, and so how long dialing through it can take.  Once connected, callers are expected to set
+// their own deadline.  Zero Timeout means no limit.
+type Dialer struct {
+	Timeout time.Duration
+}
+
+func (d Dialer) Dial(network, addr string) (net.Conn, error) {
+	if d.Timeout == 0 {
+		return proxy.Direct.Dial(network, addr)
+	}
+
+	conn, err := net.DialTimeout(network, addr, d.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(d.Timeout))
+	return conn, nil
+}
+
+// Dial connects to addr with dialer, and gives up at t.  Direct connections are bounded by t, while proxies are
+// expected to be set up with Dialer as their forward dialer.
+func Dial(dialer proxy.Dialer, network, addr string, t time.Time) (net.Conn, error) {
+	if dialer != proxy.Direct {
+		return dialer.Dial(network, addr)
+	}
+
+	timeout := time.Until(t)
+	if timeout <= 0 {
+		return nil, errors.New("timed out before connecting")
+	}
+
+	return net.DialTimeout(network, addr, timeout)
+}
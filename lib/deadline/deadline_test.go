@@ -0,0 +1,67 @@
+package deadline
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+)
+
+// silent accepts connections, and never replies
+func silent(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		var conns []net.Conn
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				for _, c := range conns {
+					c.Close()
+				}
+
+				return
+			}
+
+			conns = append(conns, conn)
+		}
+	}()
+
+	return l
+}
+
+func TestDialer(t *testing.T) {
+	l := silent(t)
+	defer l.Close()
+
+	Convey("proxy handshake gives up after Timeout", t, func() {
+		d, err := proxy.SOCKS5("tcp", l.Addr().String(), nil, Dialer{Timeout: 50 * time.Millisecond})
+		So(err, ShouldBeNil)
+
+		start := time.Now()
+		_, err = d.Dial("tcp", "example.com:8333")
+		So(err, ShouldNotBeNil)
+		So(time.Since(start), ShouldBeLessThan, time.Second)
+	})
+}
+
+func TestDial(t *testing.T) {
+	l := silent(t)
+	defer l.Close()
+
+	Convey("direct connections are made until t", t, func() {
+		conn, err := Dial(proxy.Direct, "tcp", l.Addr().String(), time.Now().Add(time.Second))
+		So(err, ShouldBeNil)
+		conn.Close()
+	})
+
+	Convey("t in the past fails w/o connecting", t, func() {
+		_, err := Dial(proxy.Direct, "tcp", l.Addr().String(), time.Now().Add(-time.Second))
+		So(err, ShouldNotBeNil)
+	})
+}
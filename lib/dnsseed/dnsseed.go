@@ -0,0 +1,175 @@
+// Package dnsseed queries Bitcoin DNS seeds, and checks if nodes they return are reachable, and advertise services
+// they were requested for, see: https://github.com/sipa/bitcoin-seeder
+package dnsseed
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+)
+
+const (
+	// NodeNetwork is the service bit seeds are expected to return by default
+	NodeNetwork uint64 = 1
+
+	// how many nodes are probed at the same time
+	maxParallel = 32
+)
+
+// seeds of Bitcoin Core, see: https://github.com/bitcoin/bitcoin/blob/master/src/kernel/chainparams.cpp
+var (
+	MainNetSeeds = []string{
+		"seed.bitcoin.sipa.be",
+		"dnsseed.bluematt.me",
+		"seed.bitcoin.jonasschnelli.ch",
+		"seed.btc.petertodd.net",
+		"seed.bitcoin.sprovoost.nl",
+		"dnsseed.emzy.de",
+		"seed.bitcoin.wiz.biz",
+		"seed.mainnet.achownodes.xyz",
+	}
+
+	TestNetSeeds = []string{
+		"testnet-seed.bitcoin.jonasschnelli.ch",
+		"seed.tbtc.petertodd.net",
+		"seed.testnet.bitcoin.sprovoost.nl",
+		"testnet-seed.bluematt.me",
+	}
+)
+
+type (
+	// Lookup returns all IPs of host
+	Lookup func(host string) ([]net.IP, error)
+
+	// Prober checks if there's a Bitcoin node at c, and returns services it advertises
+	Prober func(c connstring.ConnString) (services uint64, err error)
+
+	Node struct {
+		Address  string `json:"address"`
+		Up       bool   `json:"up"`
+		Services uint64 `json:"services,omitempty"`
+		Error    string `json:"error,omitempty"`
+	}
+
+	// Result is health of a seed, when queried for a single set of service bits
+	Result struct {
+		Seed     string `json:"seed"`
+		Query    string `json:"query"`
+		Services uint64 `json:"services"`
+		Error    string `json:"error,omitempty"`
+
+		Returned     int `json:"returned"`
+		Reachable    int `json:"reachable"`
+		WithServices int `json:"with_services"`
+
+		// fraction of returned nodes that are up, and fraction of up nodes that advertise all requested services
+		ReachableRatio float64 `json:"reachable_ratio"`
+		ServicesRatio  float64 `json:"services_ratio"`
+
+		Nodes []Node `json:"nodes,omitempty"`
+	}
+)
+
+// QueryName returns the name to query seed for nodes with services.  Seeds use `x<hex>.` subdomains to filter by
+// service bits, and return NodeNetwork nodes w/o one.
+func QueryName(seed string, services uint64) string {
+	if services == 0 {
+		return seed
+	}
+
+	return fmt.Sprintf("x%x.%s", services, seed)
+}
+
+// Check queries seed, and probes all nodes it returned on port
+func Check(seed string, services uint64, port string, lookup Lookup, probe Prober) (r Result) {
+	r = Result{
+		Seed:     seed,
+		Query:    QueryName(seed, services),
+		Services: services,
+	}
+
+	ips, err := lookup(r.Query)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+
+	want := services
+	if want == 0 {
+		want = NodeNetwork
+	}
+
+	r.Returned = len(ips)
+	r.Nodes = make([]Node, len(ips))
+
+	sem := make(chan struct{}, maxParallel)
+
+	var wg sync.WaitGroup
+	wg.Add(len(ips))
+
+	for i, ip := range ips {
+		go func(i int, ip net.IP) {
+			defer wg.Done()
+
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			r.Nodes[i] = probeNode(net.JoinHostPort(ip.String(), port), probe)
+		}(i, ip)
+	}
+
+	wg.Wait()
+
+	for _, n := range r.Nodes {
+		if !n.Up {
+			continue
+		}
+
+		r.Reachable++
+		if n.Services&want == want {
+			r.WithServices++
+		}
+	}
+
+	if r.Returned > 0 {
+		r.ReachableRatio = float64(r.Reachable) / float64(r.Returned)
+	}
+
+	if r.Reachable > 0 {
+		r.ServicesRatio = float64(r.WithServices) / float64(r.Reachable)
+	}
+
+	return
+}
+
+func probeNode(address string, probe Prober) Node {
+	n := Node{Address: address}
+
+	c, err := connstring.Parse(address)
+	if err != nil {
+		n.Error = err.Error()
+		return n
+	}
+
+	n.Services, err = probe(c)
+	if err != nil {
+		n.Error = err.Error()
+		return n
+	}
+
+	n.Up = true
+	return n
+}
+
+// ParseServices parses hex service bits, as used in seeds' `x<hex>.` subdomains
+func ParseServices(s string) (uint64, error) {
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// Healthy is true if seed returned any nodes, and enough of them are reachable, and advertise requested services
+func (r Result) Healthy(minReachable, minServices float64) bool {
+	return r.Error == "" && r.Returned > 0 && r.ReachableRatio >= minReachable && r.ServicesRatio >= minServices
+}
@@ -0,0 +1,185 @@
+package dnsseed
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/proxy"
+)
+
+// fakeDns is a minimal stand-in for a seeder's DNS server, answering A & AAAA queries over UDP
+type fakeDns struct {
+	conn    net.PacketConn
+	records map[string][]net.IP
+}
+
+func newFakeDns(records map[string][]net.IP) *fakeDns {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	f := &fakeDns{conn, records}
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeDns) Addr() string {
+	return f.conn.LocalAddr().String()
+}
+
+func (f *fakeDns) Close() {
+	_ = f.conn.Close()
+}
+
+func (f *fakeDns) serve() {
+	buf := make([]byte, 512)
+
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		reply, err := f.reply(buf[:n])
+		if err != nil {
+			continue
+		}
+
+		_, _ = f.conn.WriteTo(reply, addr)
+	}
+}
+
+func (f *fakeDns) reply(query []byte) ([]byte, error) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return nil, err
+	}
+
+	ips, ok := f.records[strings.TrimSuffix(q.Name.String(), ".")]
+
+	h.Response, h.Authoritative = true, true
+	if !ok {
+		h.RCode = dnsmessage.RCodeNameError
+	}
+
+	b := dnsmessage.NewBuilder(nil, h)
+	_ = b.StartQuestions()
+	_ = b.Question(q)
+	_ = b.StartAnswers()
+
+	for _, ip := range ips {
+		rh := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+
+		switch ip4 := ip.To4(); {
+		case q.Type == dnsmessage.TypeA && ip4 != nil:
+			var a dnsmessage.AResource
+			copy(a.A[:], ip4)
+			_ = b.AResource(rh, a)
+
+		case q.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip)
+			_ = b.AAAAResource(rh, aaaa)
+		}
+	}
+
+	return b.Finish()
+}
+
+func TestQueryName(t *testing.T) {
+	Convey("Given no service bits", t, func() {
+		So(QueryName("seed.example.com", 0), ShouldEqual, "seed.example.com")
+	})
+
+	Convey("Given service bits", t, func() {
+		So(QueryName("seed.example.com", 0x49), ShouldEqual, "x49.seed.example.com")
+
+		services, err := ParseServices("49")
+		So(err, ShouldBeNil)
+		So(services, ShouldEqual, 1|8|64)
+	})
+}
+
+func TestCheck(t *testing.T) {
+	f := newFakeDns(map[string][]net.IP{
+		"seed.example.com": {
+			net.ParseIP("10.0.0.1"),
+			net.ParseIP("10.0.0.2"),
+			net.ParseIP("10.0.0.3"),
+			net.ParseIP("fd00::4"),
+		},
+		"x9.seed.example.com": {
+			net.ParseIP("10.0.0.1"),
+			net.ParseIP("10.0.0.2"),
+		},
+	})
+	defer f.Close()
+
+	lookup := common.LookupVia(proxy.Direct, f.Addr())
+
+	// .1 is a full witness node, .2 is pruned w/o witness, .3 is down, and ::4 is a full non-witness node
+	probe := func(c connstring.ConnString) (uint64, error) {
+		switch c.Host {
+		case "10.0.0.1":
+			return 1 | 8, nil
+		case "10.0.0.2":
+			return 1024, nil
+		case "fd00::4":
+			return 1, nil
+		}
+
+		return 0, errors.New("connection refused")
+	}
+
+	Convey("Given a seed queried w/o a filter", t, func() {
+		r := Check("seed.example.com", 0, "8333", lookup, probe)
+
+		So(r.Error, ShouldBeEmpty)
+		So(r.Returned, ShouldEqual, 4)
+		So(r.Reachable, ShouldEqual, 3)
+		So(r.WithServices, ShouldEqual, 2)
+		So(r.ReachableRatio, ShouldEqual, 0.75)
+		So(r.Healthy(0.75, 0.5), ShouldBeTrue)
+		So(r.Healthy(0.75, 0.9), ShouldBeFalse)
+
+		addresses := make(map[string]Node)
+		for _, n := range r.Nodes {
+			addresses[n.Address] = n
+		}
+
+		So(addresses, ShouldContainKey, "[fd00::4]:8333")
+		So(addresses["10.0.0.3:8333"].Up, ShouldBeFalse)
+		So(addresses["10.0.0.3:8333"].Error, ShouldEqual, "connection refused")
+	})
+
+	Convey("Given a seed queried for witness nodes", t, func() {
+		r := Check("seed.example.com", 9, "8333", lookup, probe)
+
+		So(r.Query, ShouldEqual, "x9.seed.example.com")
+		So(r.Returned, ShouldEqual, 2)
+		So(r.Reachable, ShouldEqual, 2)
+		So(r.WithServices, ShouldEqual, 1)
+		So(r.ServicesRatio, ShouldEqual, 0.5)
+	})
+
+	Convey("Given a seed that doesn't support a filter", t, func() {
+		r := Check("seed.example.com", 0x49, "8333", lookup, probe)
+
+		So(r.Error, ShouldNotBeEmpty)
+		So(r.Healthy(0, 0), ShouldBeFalse)
+	})
+}
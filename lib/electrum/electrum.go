@@ -0,0 +1,201 @@
+package electrum
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	DefaultPort    = "50001"
+	DefaultTLSPort = "50002"
+
+	ClientName = "bc1isup 0.0.1"
+
+	// range of protocol versions understood, see: https://electrum-protocol.readthedocs.io/en/latest/protocol-changes.html
+	ProtocolMin = "1.4"
+	ProtocolMax = "1.6"
+
+	// responses are single lines, but ex. server.features can list many peers
+	maxResponseLength = 1 << 20
+)
+
+type (
+	// Server is what's known about an Electrum server after a single probe
+	Server struct {
+		Address     string `json:"address"`
+		Software    string `json:"server"`
+		Protocol    string `json:"protocol"`
+		ProtocolMin string `json:"protocol_min,omitempty"`
+		ProtocolMax string `json:"protocol_max,omitempty"`
+		GenesisHash string `json:"genesis_hash"`
+		Chain       string `json:"chain,omitempty"`
+		LastBlock   int    `json:"lastblock"`
+		TestNet     bool   `json:"testnet"`
+		TLS         bool   `json:"tls"`
+
+		// Latency is how long it took to connect, and negotiate protocol version
+		Latency time.Duration `json:"-"`
+	}
+
+	request struct {
+		JsonRpc string        `json:"jsonrpc"`
+		Id      int           `json:"id"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}
+
+	response struct {
+		Id     *int            `json:"id"`
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	features struct {
+		GenesisHash string `json:"genesis_hash"`
+		ProtocolMin string `json:"protocol_min"`
+		ProtocolMax string `json:"protocol_max"`
+	}
+
+	header struct {
+		Height int `json:"height"`
+	}
+
+	client struct {
+		conn   net.Conn
+		r      *bufio.Reader
+		lastId int
+	}
+)
+
+// call sends a request, and decodes its result into v.  Notifications received in the meantime are skipped.
+func (c *client) call(v interface{}, method string, params ...interface{}) error {
+	c.lastId++
+
+	req, err := json.Marshal(request{"2.0", c.lastId, method, params})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.conn.Write(append(req, '\n'))
+	if err != nil {
+		return errors.Wrapf(err, "can't send %s", method)
+	}
+
+	for {
+		line, err := c.r.ReadSlice('\n')
+		if err != nil {
+			return errors.Wrapf(err, "can't read response to %s", method)
+		}
+
+		var resp response
+		err = json.Unmarshal(line, &resp)
+		if err != nil {
+			return errors.Wrapf(err, "server responded to %s with invalid JSON", method)
+		}
+
+		if resp.Id == nil || *resp.Id != c.lastId {
+			continue
+		}
+
+		if resp.Error != nil {
+			return errors.Errorf("%s failed: %s (%d)", method, resp.Error.Message, resp.Error.Code)
+		}
+
+		return errors.Wrapf(json.Unmarshal(resp.Result, v), "unexpected response to %s", method)
+	}
+}
+
+// Probe connects to an Electrum server at addr, negotiates protocol version, and asks for its features & tip.  With
+// useTLS, certificates aren't verified, as most servers use self-signed ones.
+func Probe(dialer proxy.Dialer, addr connstring.ConnString, useTLS bool, timeout time.Duration) (s Server, err error) {
+	log := common.Logger.Get().WithField("address", addr.Raw)
+
+	if addr.Port == "" {
+		addr.Port = DefaultPort
+
+		if useTLS {
+			addr.Port = DefaultTLSPort
+		}
+	}
+
+	start := time.Now()
+
+	log.Debugln("connecting…")
+	conn, err := deadline.Dial(dialer, "tcp", net.JoinHostPort(addr.Host, addr.Port), start.Add(timeout))
+	if err != nil {
+		return s, errors.Wrap(err, "can't connect to server")
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(start.Add(timeout))
+
+	if useTLS {
+		config := &tls.Config{InsecureSkipVerify: true}
+		if addr.IP == nil {
+			config.ServerName = addr.Host
+		}
+
+		tlsConn := tls.Client(conn, config)
+		err = tlsConn.Handshake()
+		if err != nil {
+			return s, errors.Wrap(err, "TLS handshake failed")
+		}
+
+		conn = tlsConn
+	}
+
+	c := &client{conn: conn, r: bufio.NewReaderSize(conn, maxResponseLength)}
+
+	var version []string
+	err = c.call(&version, "server.version", ClientName, []string{ProtocolMin, ProtocolMax})
+	if err != nil {
+		return s, err
+	}
+
+	if len(version) != 2 {
+		return s, errors.New("server.version returned unexpected response")
+	}
+
+	s = Server{
+		Address:  addr.ToString(),
+		Software: version[0],
+		Protocol: version[1],
+		TLS:      useTLS,
+		Latency:  time.Since(start),
+	}
+
+	var f features
+	err = c.call(&f, "server.features")
+	if err != nil {
+		return s, err
+	}
+
+	s.ProtocolMin, s.ProtocolMax, s.GenesisHash = f.ProtocolMin, f.ProtocolMax, f.GenesisHash
+	s.Chain = btc.ChainOf(f.GenesisHash)
+	s.TestNet = s.Chain != btc.ChainMain
+
+	var tip header
+	err = c.call(&tip, "blockchain.headers.subscribe")
+	if err != nil {
+		return s, err
+	}
+
+	s.LastBlock = tip.Height
+
+	log.WithField("server", s.Software).Debugln("server probed")
+	return s, nil
+}
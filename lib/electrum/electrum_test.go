@@ -0,0 +1,98 @@
+package electrum
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+)
+
+// serve answers requests like an ElectrumX server would, with a notification thrown in before each response
+func serve(t *testing.T, results map[string]interface{}) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				enc, dec := json.NewEncoder(conn), json.NewDecoder(bufio.NewReader(conn))
+				for {
+					var req request
+					if dec.Decode(&req) != nil {
+						return
+					}
+
+					_ = enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "method": "blockchain.headers.subscribe", "params": []interface{}{}})
+
+					result, ok := results[req.Method]
+					if !ok {
+						_ = enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "error": map[string]interface{}{"code": -32601, "message": "unknown method"}})
+						continue
+					}
+
+					_ = enc.Encode(map[string]interface{}{"jsonrpc": "2.0", "id": req.Id, "result": result})
+				}
+			}(conn)
+		}
+	}()
+
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func TestProbe(t *testing.T) {
+	Convey("Given a mainnet Electrum server", t, func() {
+		addr, err := connstring.Parse("electrum://" + serve(t, map[string]interface{}{
+			"server.version":               []string{"ElectrumX 1.16.0", "1.4"},
+			"server.features":              map[string]interface{}{"genesis_hash": btc.GenesisHashes[btc.ChainMain], "protocol_min": "1.4", "protocol_max": "1.4.2"},
+			"blockchain.headers.subscribe": map[string]interface{}{"height": 868123, "hex": "00"},
+		}))
+		So(err, ShouldBeNil)
+
+		s, err := Probe(proxy.Direct, addr, false, time.Second)
+
+		So(err, ShouldBeNil)
+		So(s.Software, ShouldEqual, "ElectrumX 1.16.0")
+		So(s.Protocol, ShouldEqual, "1.4")
+		So(s.ProtocolMax, ShouldEqual, "1.4.2")
+		So(s.Chain, ShouldEqual, btc.ChainMain)
+		So(s.TestNet, ShouldBeFalse)
+		So(s.LastBlock, ShouldEqual, 868123)
+	})
+
+	Convey("Given a server failing a call", t, func() {
+		addr, err := connstring.Parse("electrum://" + serve(t, map[string]interface{}{
+			"server.version": []string{"Fulcrum 1.11.1", "1.4"},
+		}))
+		So(err, ShouldBeNil)
+
+		_, err = Probe(proxy.Direct, addr, false, time.Second)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "server.features failed: unknown method")
+	})
+
+	Convey("Given nothing listening", t, func() {
+		addr, err := connstring.Parse("electrum://127.0.0.1:1")
+		So(err, ShouldBeNil)
+
+		_, err = Probe(proxy.Direct, addr, false, time.Second)
+
+		So(err, ShouldNotBeNil)
+	})
+}
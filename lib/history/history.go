@@ -0,0 +1,422 @@
+package history
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	FileName = "history.db"
+
+	// other runs (ex. --watch) might be writing at the same time, so waiting for them is limited
+	lockTimeout = 5 * time.Second
+)
+
+var (
+	// all probes are kept in a bucket per target, keyed by time
+	probesBucket = []byte("probes")
+
+	// time of the first record of the current streak of each target, so that it doesn't have to be looked for
+	streaksBucket = []byte("streaks")
+)
+
+type (
+	// Node is a node found at target during a single probe
+	Node struct {
+		Address   string        `json:"address"`
+		UserAgent string        `json:"useragent"`
+		Protocol  int           `json:"protocol"`
+		Services  uint64        `json:"services"`
+		LastBlock int           `json:"lastblock"`
+		TestNet   bool          `json:"testnet"`
+		Latency   time.Duration `json:"latency"`
+	}
+
+	// Record is an outcome of a single probe of a target
+	Record struct {
+		Time   time.Time `json:"time"`
+		Up     bool      `json:"up"`
+		Nodes  []Node    `json:"nodes,omitempty"`
+		Errors []string  `json:"errors,omitempty"`
+	}
+
+	// Version is a period during which target was seen running the same version(s)
+	Version struct {
+		Version string    `json:"version"`
+		From    time.Time `json:"from"`
+		To      time.Time `json:"to"`
+	}
+
+	// Latency percentiles, in milliseconds
+	Latency struct {
+		P50 float64 `json:"p50"`
+		P90 float64 `json:"p90"`
+		P99 float64 `json:"p99"`
+	}
+
+	// Report summarises all probes of a target
+	Report struct {
+		Target   string     `json:"target"`
+		Probes   int        `json:"probes"`
+		Uptime   float64    `json:"uptime"`
+		LastSeen *time.Time `json:"last_seen,omitempty"`
+		Versions []Version  `json:"versions"`
+		Latency  *Latency   `json:"latency_ms,omitempty"`
+	}
+
+	Store struct {
+		db *bolt.DB
+	}
+)
+
+// DefaultPath returns location of the history file within toolkit's data directory
+func DefaultPath() string {
+	return filepath.Join(common.GetDataDir(), FileName)
+}
+
+// Open opens, or creates history file at path
+func Open(path string) (*Store, error) {
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create directory for %s", path)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: lockTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open history file %s", path)
+	}
+
+	return &Store{db}, nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+func lastRecord(b *bolt.Bucket, target string) (r Record, err error) {
+	_, v := b.Cursor().Last()
+	if v == nil {
+		return
+	}
+
+	err = json.Unmarshal(v, &r)
+	if err != nil {
+		return r, errors.Wrapf(err, "corrupted record of %s", target)
+	}
+
+	return
+}
+
+// streakStart returns when the current streak of target started.  Files written before streaks were stored have it
+// looked for once, by going back through records.
+func streakStart(tx *bolt.Tx, b *bolt.Bucket, target string, last Record) (since time.Time, err error) {
+	if streaks := tx.Bucket(streaksBucket); streaks != nil {
+		if v := streaks.Get([]byte(target)); v != nil {
+			return time.Unix(0, int64(binary.BigEndian.Uint64(v))), nil
+		}
+	}
+
+	c := b.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		var r Record
+		err := json.Unmarshal(v, &r)
+		if err != nil {
+			return since, errors.Wrapf(err, "corrupted record of %s", target)
+		}
+
+		if r.Up != last.Up {
+			break
+		}
+
+		since = r.Time
+	}
+
+	return
+}
+
+// Add saves records of many targets at once
+func (s *Store) Add(records map[string]Record) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		probes, err := tx.CreateBucketIfNotExists(probesBucket)
+		if err != nil {
+			return err
+		}
+
+		streaks, err := tx.CreateBucketIfNotExists(streaksBucket)
+		if err != nil {
+			return err
+		}
+
+		for target, r := range records {
+			b, err := probes.CreateBucketIfNotExists([]byte(target))
+			if err != nil {
+				return errors.Wrapf(err, "unable to create bucket for %s", target)
+			}
+
+			last, err := lastRecord(b, target)
+			if err != nil {
+				return err
+			}
+
+			// streak continues only if target is in the same state as it was last time
+			since := r.Time
+			if !last.Time.IsZero() && last.Up == r.Up {
+				since, err = streakStart(tx, b, target, last)
+				if err != nil {
+					return err
+				}
+			}
+
+			err = streaks.Put([]byte(target), timeKey(since))
+			if err != nil {
+				return err
+			}
+
+			v, err := json.Marshal(r)
+			if err != nil {
+				return err
+			}
+
+			// NOTE: two probes of the same target never finish within the same nanosecond
+			err = b.Put(timeKey(r.Time), v)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// Targets returns all targets with any records
+func (s *Store) Targets() (targets []string, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		probes := tx.Bucket(probesBucket)
+		if probes == nil {
+			return nil
+		}
+
+		return probes.ForEach(func(k, _ []byte) error {
+			targets = append(targets, string(k))
+			return nil
+		})
+	})
+
+	return
+}
+
+// Get returns all records of target since given time (all if zero), oldest first
+func (s *Store) Get(target string, since time.Time) (records []Record, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		probes := tx.Bucket(probesBucket)
+		if probes == nil {
+			return nil
+		}
+
+		b := probes.Bucket([]byte(target))
+		if b == nil {
+			return nil
+		}
+
+		// NOTE: zero time is out of range of UnixNano()
+		c := b.Cursor()
+		k, v := c.First()
+		if !since.IsZero() {
+			k, v = c.Seek(timeKey(since))
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			var r Record
+			err := json.Unmarshal(v, &r)
+			if err != nil {
+				return errors.Wrapf(err, "corrupted record of %s", target)
+			}
+
+			records = append(records, r)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// Streak returns the last record of target, and since when target is in the same state (up, or down) as then.  Last
+// record has zero time, if there's none.  Streaks are kept even once their first records are pruned.
+func (s *Store) Streak(target string) (last Record, since time.Time, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		probes := tx.Bucket(probesBucket)
+		if probes == nil {
+			return nil
+		}
+
+		b := probes.Bucket([]byte(target))
+		if b == nil {
+			return nil
+		}
+
+		last, err = lastRecord(b, target)
+		if err != nil || last.Time.IsZero() {
+			return err
+		}
+
+		since, err = streakStart(tx, b, target, last)
+		return err
+	})
+
+	return
+}
+
+// Prune removes all records older than before, and targets left w/o any, and returns how many records were removed
+func (s *Store) Prune(before time.Time) (removed int, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		probes := tx.Bucket(probesBucket)
+		if probes == nil {
+			return nil
+		}
+
+		var empty [][]byte
+		err := probes.ForEach(func(target, _ []byte) error {
+			b := probes.Bucket(target)
+
+			// NOTE: deleting while iterating skips keys, so old ones are collected first
+			var old [][]byte
+			c := b.Cursor()
+			for k, _ := c.First(); k != nil && bytes.Compare(k, timeKey(before)) < 0; k, _ = c.Next() {
+				old = append(old, k)
+			}
+
+			for _, k := range old {
+				err := b.Delete(k)
+				if err != nil {
+					return err
+				}
+			}
+
+			removed += len(old)
+
+			if k, _ := c.First(); k == nil {
+				empty = append(empty, target)
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		streaks := tx.Bucket(streaksBucket)
+		for _, target := range empty {
+			err = probes.DeleteBucket(target)
+			if err != nil {
+				return errors.Wrapf(err, "unable to remove %s", target)
+			}
+
+			if streaks != nil {
+				err = streaks.Delete(target)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// Version returns all versions of nodes found in r, sorted, or "" if none were found.  Protocol is omitted where it's
+// not known, ex. for Electrum servers.
+func (r Record) Version() string {
+	var list []string
+	for _, n := range r.Nodes {
+		if n.Protocol == 0 {
+			list = append(list, n.UserAgent)
+			continue
+		}
+
+		list = append(list, fmt.Sprintf("%s (%d)", n.UserAgent, n.Protocol))
+	}
+
+	sort.Strings(list)
+	return strings.Join(list, ", ")
+}
+
+// percentile returns p-th percentile of sorted values, using nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// Summarise returns uptime, version timeline and latency percentiles of target, based on its records sorted oldest first
+func Summarise(target string, records []Record) Report {
+	r := Report{
+		Target:   target,
+		Probes:   len(records),
+		Versions: []Version{},
+	}
+
+	var up int
+	var latencies []float64
+
+	for _, rec := range records {
+		if !rec.Up {
+			continue
+		}
+
+		up++
+
+		t := rec.Time
+		r.LastSeen = &t
+
+		for _, n := range rec.Nodes {
+			latencies = append(latencies, float64(n.Latency)/float64(time.Millisecond))
+		}
+
+		v := rec.Version()
+		if last := len(r.Versions) - 1; last >= 0 && r.Versions[last].Version == v {
+			r.Versions[last].To = rec.Time
+			continue
+		}
+
+		r.Versions = append(r.Versions, Version{v, rec.Time, rec.Time})
+	}
+
+	if len(records) > 0 {
+		r.Uptime = float64(up) / float64(len(records))
+	}
+
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		r.Latency = &Latency{
+			P50: percentile(latencies, 50),
+			P90: percentile(latencies, 90),
+			P99: percentile(latencies, 99),
+		}
+	}
+
+	return r
+}
@@ -0,0 +1,165 @@
+package history
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+	bolt "go.etcd.io/bbolt"
+)
+
+func node(userAgent string, latency time.Duration) Node {
+	return Node{Address: "1.1.1.1:8333", UserAgent: userAgent, Protocol: 70016, Latency: latency}
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	Convey("Given a new history file", t, func() {
+		s, err := Open(filepath.Join(dir, "nested", FileName))
+		So(err, ShouldBeNil)
+		defer s.Close()
+
+		start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+		for i := 0; i < 3; i++ {
+			err = s.Add(map[string]Record{
+				"a.example": {Time: start.Add(time.Duration(i) * time.Hour), Up: true, Nodes: []Node{node("/a/", time.Second)}},
+				"b.example": {Time: start.Add(time.Duration(i) * time.Hour), Errors: []string{"connection refused"}},
+			})
+			So(err, ShouldBeNil)
+		}
+
+		Convey("all targets should be listed", func() {
+			targets, err := s.Targets()
+			So(err, ShouldBeNil)
+			So(targets, ShouldResemble, []string{"a.example", "b.example"})
+		})
+
+		Convey("records should be returned oldest first, since given time", func() {
+			records, err := s.Get("a.example", start.Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 2)
+			So(records[0].Time.Equal(start.Add(time.Hour)), ShouldBeTrue)
+			So(records[1].Nodes[0].Latency, ShouldEqual, time.Second)
+		})
+
+		Convey("zero time should return all records", func() {
+			records, err := s.Get("b.example", time.Time{})
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 3)
+			So(records[0].Errors, ShouldResemble, []string{"connection refused"})
+		})
+
+		Convey("unknown target should have no records", func() {
+			records, err := s.Get("c.example", start)
+			So(err, ShouldBeNil)
+			So(records, ShouldBeEmpty)
+		})
+
+		Convey("streak should start at the first record in the same state as the last one", func() {
+			err := s.Add(map[string]Record{"a.example": {Time: start.Add(3 * time.Hour)}})
+			So(err, ShouldBeNil)
+
+			last, since, err := s.Streak("a.example")
+			So(err, ShouldBeNil)
+			So(last.Up, ShouldBeFalse)
+			So(since.Equal(start.Add(3*time.Hour)), ShouldBeTrue)
+
+			_, since, err = s.Streak("b.example")
+			So(err, ShouldBeNil)
+			So(since.Equal(start), ShouldBeTrue)
+
+			last, _, err = s.Streak("c.example")
+			So(err, ShouldBeNil)
+			So(last.Time.IsZero(), ShouldBeTrue)
+		})
+
+		Convey("streak should be looked for in records, if file has none stored", func() {
+			err := s.db.Update(func(tx *bolt.Tx) error {
+				return tx.DeleteBucket(streaksBucket)
+			})
+			So(err, ShouldBeNil)
+
+			_, since, err := s.Streak("b.example")
+			So(err, ShouldBeNil)
+			So(since.Equal(start), ShouldBeTrue)
+
+			err = s.Add(map[string]Record{"b.example": {Time: start.Add(3 * time.Hour)}})
+			So(err, ShouldBeNil)
+
+			_, since, err = s.Streak("b.example")
+			So(err, ShouldBeNil)
+			So(since.Equal(start), ShouldBeTrue)
+		})
+
+		Convey("records older than given time should be pruned", func() {
+			err := s.Add(map[string]Record{"c.example": {Time: start}})
+			So(err, ShouldBeNil)
+
+			removed, err := s.Prune(start.Add(2 * time.Hour))
+			So(err, ShouldBeNil)
+			So(removed, ShouldEqual, 5)
+
+			records, err := s.Get("a.example", time.Time{})
+			So(err, ShouldBeNil)
+			So(records, ShouldNotBeEmpty)
+			So(records[0].Time.Equal(start.Add(2*time.Hour)), ShouldBeTrue)
+
+			Convey("targets left w/o records should be removed", func() {
+				targets, err := s.Targets()
+				So(err, ShouldBeNil)
+				So(targets, ShouldResemble, []string{"a.example", "b.example"})
+			})
+
+			Convey("streaks should still start at their first record", func() {
+				_, since, err := s.Streak("b.example")
+				So(err, ShouldBeNil)
+				So(since.Equal(start), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestSummarise(t *testing.T) {
+	Convey("Given records of a target, that got upgraded", t, func() {
+		start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+		at := func(h int) time.Time { return start.Add(time.Duration(h) * time.Hour) }
+
+		records := []Record{
+			{Time: at(0), Up: true, Nodes: []Node{node("/Satoshi:26.0.0/", 10*time.Millisecond)}},
+			{Time: at(1), Up: true, Nodes: []Node{node("/Satoshi:26.0.0/", 20*time.Millisecond)}},
+			{Time: at(2), Errors: []string{"timeout"}},
+			{Time: at(3), Up: true, Nodes: []Node{node("/Satoshi:27.0.0/", 30*time.Millisecond)}},
+		}
+
+		r := Summarise("a.example", records)
+
+		So(r.Probes, ShouldEqual, 4)
+		So(r.Uptime, ShouldEqual, 0.75)
+		So(r.LastSeen.Equal(at(3)), ShouldBeTrue)
+
+		So(r.Versions, ShouldHaveLength, 2)
+		So(r.Versions[0].Version, ShouldEqual, "/Satoshi:26.0.0/ (70016)")
+		So(r.Versions[0].To.Equal(at(1)), ShouldBeTrue)
+		So(r.Versions[1].From.Equal(at(3)), ShouldBeTrue)
+
+		So(r.Latency.P50, ShouldEqual, 20)
+		So(r.Latency.P99, ShouldEqual, 30)
+	})
+
+	Convey("Given no records", t, func() {
+		r := Summarise("a.example", nil)
+
+		So(r.Uptime, ShouldEqual, 0)
+		So(r.LastSeen, ShouldBeNil)
+		So(r.Latency, ShouldBeNil)
+	})
+}
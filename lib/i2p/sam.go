@@ -0,0 +1,193 @@
+// Package i2p implements a minimal SAM v3 client, just enough to open streams to .b32.i2p addresses,
+// see: https://geti2p.net/en/docs/api/samv3
+package i2p
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/keyvalue"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultSam = "127.0.0.1:7656"
+
+	samVersion  = "3.1"
+	dialTimeout = 5 * time.Second
+
+	// creating tunnels can take a while
+	sessionTimeout = 2 * time.Minute
+
+	resultOk = "OK"
+)
+
+// Dialer opens streams through a single transient SAM session.  It implements proxy.Dialer.
+type Dialer struct {
+	// bounds Dial(), incl. looking up the destination.  Zero means sessionTimeout.
+	Timeout time.Duration
+
+	samAddr   string
+	sessionId string
+
+	mu      sync.Mutex
+	session net.Conn
+}
+
+type samConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// NewDialer creates a new transient destination, which can take tens of seconds.  Close() removes it.
+func NewDialer(samAddr string) (*Dialer, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Dialer{
+		samAddr:   samAddr,
+		sessionId: "bc1toolkit-" + hex.EncodeToString(id),
+	}
+
+	c, err := d.hello()
+	if err != nil {
+		return nil, err
+	}
+
+	_ = c.SetDeadline(time.Now().Add(sessionTimeout))
+
+	// NOTE: signature type 7 is Ed25519, the same Bitcoin Core uses
+	_, err = c.command("SESSION", "STATUS", "SESSION CREATE STYLE=STREAM ID=%s DESTINATION=TRANSIENT SIGNATURE_TYPE=7", d.sessionId)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "can't create I2P session")
+	}
+
+	// session lives as long as this connection does
+	_ = c.SetDeadline(time.Time{})
+	d.session = c
+
+	return d, nil
+}
+
+func (d *Dialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.session == nil {
+		return nil
+	}
+
+	err := d.session.Close()
+	d.session = nil
+	return err
+}
+
+func (d *Dialer) hello() (*samConn, error) {
+	conn, err := net.DialTimeout("tcp", d.samAddr, dialTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't connect to I2P SAM bridge")
+	}
+
+	c := &samConn{conn, bufio.NewReader(conn)}
+	_ = c.SetDeadline(time.Now().Add(dialTimeout))
+
+	_, err = c.command("HELLO", "REPLY", "HELLO VERSION MIN=%s MAX=%s", samVersion, samVersion)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrap(err, "SAM handshake failed")
+	}
+
+	return c, nil
+}
+
+// Dial connects to a .b32.i2p address.  Port is ignored, as SAM 3.1 streams have none.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	closed := d.session == nil
+	d.mu.Unlock()
+
+	if closed {
+		return nil, errors.New("I2P session closed")
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	c, err := d.hello()
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = sessionTimeout
+	}
+
+	_ = c.SetDeadline(time.Now().Add(timeout))
+
+	reply, err := c.command("NAMING", "REPLY", "NAMING LOOKUP NAME=%s", host)
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrapf(err, "can't look up %s", host)
+	}
+
+	_, err = c.command("STREAM", "STATUS", "STREAM CONNECT ID=%s DESTINATION=%s SILENT=false", d.sessionId, reply["VALUE"])
+	if err != nil {
+		c.Close()
+		return nil, errors.Wrapf(err, "can't connect to %s", host)
+	}
+
+	_ = c.SetDeadline(time.Time{})
+
+	// from now on it's a raw stream, but some bytes might've been buffered already
+	return c, nil
+}
+
+func (c *samConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// command sends a line, and expects a `<topic> <kind> RESULT=OK …` reply
+func (c *samConn) command(topic, kind, format string, args ...interface{}) (map[string]string, error) {
+	_, err := fmt.Fprintf(c.Conn, format+"\n", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	words := strings.SplitN(strings.TrimSpace(line), " ", 3)
+	if len(words) < 2 || words[0] != topic || words[1] != kind {
+		return nil, errors.Errorf("unexpected SAM reply: %q", line)
+	}
+
+	reply := make(map[string]string)
+	if len(words) == 3 {
+		reply = keyvalue.Parse(words[2])
+	}
+
+	if reply["RESULT"] != resultOk {
+		if msg := reply["MESSAGE"]; msg != "" {
+			return nil, errors.Errorf("%s: %s", reply["RESULT"], msg)
+		}
+
+		return nil, errors.New(reply["RESULT"])
+	}
+
+	return reply, nil
+}
@@ -0,0 +1,134 @@
+package i2p
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/meeDamian/bc1toolkit/lib/keyvalue"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	knownPeer   = "h3r6bkn46qxftwja53pxiykntegfyfjqtnzbm6iv6r5mungmqgmq.b32.i2p"
+	knownDest   = "known-peer-destination-base64~"
+	unknownPeer = "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.b32.i2p"
+)
+
+// fakeSam is a minimal stand-in for I2P router's SAM bridge.  Connected streams echo everything back.
+func fakeSam() (addr string, closeFn func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go serveSam(conn)
+		}
+	}()
+
+	return l.Addr().String(), func() { _ = l.Close() }
+}
+
+func serveSam(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(conn, format+"\n", args...)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		kv := keyvalue.Parse(line[strings.Index(line, " ")+1:])
+
+		switch {
+		case strings.HasPrefix(line, "HELLO VERSION"):
+			w("HELLO REPLY RESULT=OK VERSION=3.1")
+
+		case strings.HasPrefix(line, "SESSION CREATE"):
+			w("SESSION STATUS RESULT=OK DESTINATION=our-private-destination")
+
+		case strings.HasPrefix(line, "NAMING LOOKUP"):
+			if kv["NAME"] != knownPeer {
+				w("NAMING REPLY RESULT=KEY_NOT_FOUND NAME=%s", kv["NAME"])
+				continue
+			}
+
+			w("NAMING REPLY RESULT=OK NAME=%s VALUE=%s", kv["NAME"], knownDest)
+
+		case strings.HasPrefix(line, "STREAM CONNECT"):
+			if kv["DESTINATION"] != knownDest {
+				w(`STREAM STATUS RESULT=CANT_REACH_PEER MESSAGE="peer unreachable"`)
+				return
+			}
+
+			w("STREAM STATUS RESULT=OK")
+			_, _ = io.Copy(conn, r)
+			return
+
+		default:
+			w(`%s RESULT=I2P_ERROR MESSAGE="unknown command"`, line)
+			return
+		}
+	}
+}
+
+func TestDialer(t *testing.T) {
+	Convey("Given a SAM bridge", t, func() {
+		addr, closeSam := fakeSam()
+		defer closeSam()
+
+		d, err := NewDialer(addr)
+		So(err, ShouldBeNil)
+		defer d.Close()
+
+		Convey("a stream to a known peer should be usable", func() {
+			conn, err := d.Dial("tcp", knownPeer+":0")
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("ping"))
+			So(err, ShouldBeNil)
+
+			pong := make([]byte, 4)
+			_, err = io.ReadFull(conn, pong)
+			So(err, ShouldBeNil)
+			So(string(pong), ShouldEqual, "ping")
+		})
+
+		Convey("unknown peer should return an error", func() {
+			_, err := d.Dial("tcp", unknownPeer+":0")
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "KEY_NOT_FOUND")
+		})
+
+		Convey("closed dialer should not dial", func() {
+			So(d.Close(), ShouldBeNil)
+
+			_, err := d.Dial("tcp", knownPeer+":0")
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given nothing listening", t, func() {
+		addr, closeSam := fakeSam()
+		closeSam()
+
+		_, err := NewDialer(addr)
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,55 @@
+package keyvalue
+
+import "strings"
+
+// Parse parses space-separated `KEY=VALUE` pairs, as used by Tor control port & I2P SAM replies, where VALUE can be a
+// quoted string with backslash escapes.  Words w/o `=` are skipped.
+func Parse(s string) map[string]string {
+	kv := make(map[string]string)
+
+	for s = strings.TrimSpace(s); len(s) > 0; s = strings.TrimSpace(s) {
+		eq := strings.IndexByte(s, '=')
+		sp := strings.IndexByte(s, ' ')
+		if eq == -1 {
+			break
+		}
+
+		// a bare word
+		if sp != -1 && sp < eq {
+			s = s[sp+1:]
+			continue
+		}
+
+		key := s[:eq]
+		s = s[eq+1:]
+
+		if !strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s, ' ')
+			if end == -1 {
+				end = len(s)
+			}
+
+			kv[key], s = s[:end], s[end:]
+			continue
+		}
+
+		var value strings.Builder
+		i := 1
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+			}
+
+			value.WriteByte(s[i])
+		}
+
+		kv[key] = value.String()
+		if i < len(s) {
+			i++
+		}
+
+		s = s[i:]
+	}
+
+	return kv
+}
@@ -0,0 +1,33 @@
+package keyvalue
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Given a Tor line with quoted & bare values", t, func() {
+		kv := Parse(`NOTICE BOOTSTRAP PROGRESS=100 TAG=done SUMMARY="Done \"really\""`)
+
+		So(kv["PROGRESS"], ShouldEqual, "100")
+		So(kv["TAG"], ShouldEqual, "done")
+		So(kv["SUMMARY"], ShouldEqual, `Done "really"`)
+		So(kv, ShouldNotContainKey, "NOTICE")
+	})
+
+	Convey("Given a SAM reply line with quoted values", t, func() {
+		kv := Parse("RESULT=CANT_REACH_PEER MESSAGE=\"peer is offline\" X=1\n")
+
+		So(kv["RESULT"], ShouldEqual, "CANT_REACH_PEER")
+		So(kv["MESSAGE"], ShouldEqual, "peer is offline")
+		So(kv["X"], ShouldEqual, "1")
+	})
+
+	Convey("Given an empty value, and an unterminated quote", t, func() {
+		kv := Parse(`A= B="open`)
+
+		So(kv["A"], ShouldEqual, "")
+		So(kv["B"], ShouldEqual, "open")
+	})
+}
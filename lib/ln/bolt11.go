@@ -0,0 +1,521 @@
+package ln
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/meeDamian/bc1toolkit/lib/bech32"
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/pkg/errors"
+)
+
+const (
+	invoicePrefix = "ln"
+	uriPrefix     = "lightning:"
+
+	DefaultExpiry             = 3600
+	DefaultMinFinalCltvExpiry = 18
+
+	timestampLen = 7
+	signatureLen = 104 // 520 bits: 64 bytes of signature + 1 byte of recovery id
+
+	hashLen   = 52 // 5-bit groups in a 256-bit hash
+	pubKeyLen = 53 // 5-bit groups in a 33-byte compressed pubkey
+	hopLen    = 51 // bytes in a single routing hint hop
+
+	msatPerBtc uint64 = 100000000000
+)
+
+// tagged fields as defined in BOLT-11
+const (
+	tagPaymentHash     = 1
+	tagRouteHint       = 3
+	tagFeatures        = 5
+	tagExpiry          = 6
+	tagFallback        = 9
+	tagDescription     = 13
+	tagPaymentSecret   = 16
+	tagPayee           = 19
+	tagDescriptionHash = 23
+	tagMinFinalCltv    = 24
+	tagMetadata        = 27
+)
+
+type (
+	chain struct {
+		Name      string
+		SegWitHrp string
+		P2PKH     byte
+		P2SH      byte
+
+		// genesis block hash in internal byte order, as used by BOLT-12 chain fields
+		Genesis string
+	}
+
+	RouteHop struct {
+		PubKey                    string `json:"pubkey"`
+		ShortChannelId            string `json:"short_channel_id"`
+		FeeBaseMsat               uint32 `json:"fee_base_msat"`
+		FeeProportionalMillionths uint32 `json:"fee_proportional_millionths"`
+		CltvExpiryDelta           uint16 `json:"cltv_expiry_delta"`
+	}
+
+	Feature struct {
+		Bit      int    `json:"bit"`
+		Name     string `json:"name,omitempty"`
+		Required bool   `json:"required"`
+	}
+
+	Invoice struct {
+		Network            string       `json:"network"`
+		AmountMsat         *uint64      `json:"amount_msat,omitempty"`
+		Timestamp          int64        `json:"timestamp"`
+		Expiry             int64        `json:"expiry"`
+		PaymentHash        string       `json:"payment_hash"`
+		PaymentSecret      string       `json:"payment_secret,omitempty"`
+		Description        *string      `json:"description,omitempty"`
+		DescriptionHash    string       `json:"description_hash,omitempty"`
+		Metadata           string       `json:"metadata,omitempty"`
+		Payee              string       `json:"payee"`
+		MinFinalCltvExpiry uint64       `json:"min_final_cltv_expiry"`
+		Fallbacks          []string     `json:"fallbacks,omitempty"`
+		RouteHints         [][]RouteHop `json:"route_hints,omitempty"`
+		Features           []Feature    `json:"features,omitempty"`
+		Signature          string       `json:"signature"`
+	}
+)
+
+var (
+	// NOTE: order matters, as "bc" is a prefix of "bcrt", and "tb" of "tbs"
+	chainPrefixes = []string{"bcrt", "bc", "tbs", "tb"}
+
+	chains = map[string]chain{
+		"bc":   {"mainnet", "bc", btc.P2PKHMainNet, btc.P2SHMainNet, "6fe28c0ab6f1b372c1a6a246ae63f74f931e8365e15a089c68d6190000000000"},
+		"tb":   {"testnet", "tb", btc.P2PKHTestNet, btc.P2SHTestNet, "43497fd7f826957108f4a30fd9cec3aeba79972084e90ead01ea330900000000"},
+		"tbs":  {"signet", "tb", btc.P2PKHTestNet, btc.P2SHTestNet, "f61eee3b63a380a477a063af32b2bbc97c9ff9f01f2c4225e973988108000000"},
+		"bcrt": {"regtest", "bcrt", btc.P2PKHTestNet, btc.P2SHTestNet, "06226e46111a0b59caaf126043eb5bbf28c34f3a5e332a1fc7b2b73cf188910f"},
+	}
+
+	multipliers = map[byte]uint64{
+		'm': msatPerBtc / 1000,
+		'u': msatPerBtc / 1000000,
+		'n': msatPerBtc / 1000000000,
+	}
+
+	// https://github.com/lightning/bolts/blob/master/09-features.md
+	featureNames = map[int]string{
+		0:  "option_data_loss_protect",
+		4:  "option_upfront_shutdown_script",
+		6:  "gossip_queries",
+		8:  "var_onion_optin",
+		10: "gossip_queries_ex",
+		12: "option_static_remotekey",
+		14: "payment_secret",
+		16: "basic_mpp",
+		18: "option_support_large_channel",
+		20: "option_anchor_outputs",
+		22: "option_anchors_zero_fee_htlc_tx",
+		24: "option_route_blinding",
+		26: "option_shutdown_anysegwit",
+		28: "option_dual_fund",
+		38: "option_onion_messages",
+		44: "option_channel_type",
+		46: "option_scid_alias",
+		48: "option_payment_metadata",
+		50: "option_zeroconf",
+	}
+)
+
+func (i Invoice) ExpiresAt() time.Time {
+	return time.Unix(i.Timestamp+i.Expiry, 0)
+}
+
+func (i Invoice) IsExpired(now time.Time) bool {
+	return !now.Before(i.ExpiresAt())
+}
+
+func newFeature(bit int) Feature {
+	return Feature{
+		Bit:      bit,
+		Name:     featureNames[bit&^1],
+		Required: bit%2 == 0,
+	}
+}
+
+func formatShortChannelId(scid uint64) string {
+	return fmt.Sprintf("%dx%dx%d", scid>>40, scid>>16&0xffffff, scid&0xffff)
+}
+
+// StripUri removes the optional `lightning:` URI scheme, and lowercases the string
+func StripUri(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.TrimPrefix(s, uriPrefix)
+}
+
+func parseAmount(amount string) (*uint64, error) {
+	if amount == "" {
+		return nil, nil
+	}
+
+	multiplier := msatPerBtc
+	last := amount[len(amount)-1]
+	if last < '0' || last > '9' {
+		amount = amount[:len(amount)-1]
+
+		if last == 'p' {
+			// pico-BTC is the only unit smaller than a milli-satoshi
+			if !strings.HasSuffix(amount, "0") {
+				return nil, errors.New("pico-BTC amount not a multiple of 10")
+			}
+
+			amount, multiplier = amount[:len(amount)-1], 1
+
+		} else {
+			m, ok := multipliers[last]
+			if !ok {
+				return nil, errors.Errorf("unknown amount multiplier: %q", last)
+			}
+
+			multiplier = m
+		}
+	}
+
+	value, err := strconv.ParseUint(amount, 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid amount")
+	}
+
+	msat := value * multiplier
+	if multiplier != 0 && msat/multiplier != value {
+		return nil, errors.New("amount too large")
+	}
+
+	return &msat, nil
+}
+
+func parseHrp(hrp string) (c chain, amount *uint64, err error) {
+	if !strings.HasPrefix(hrp, invoicePrefix) {
+		return c, nil, errors.Errorf("invalid prefix: %s", hrp)
+	}
+
+	hrp = strings.TrimPrefix(hrp, invoicePrefix)
+	for _, prefix := range chainPrefixes {
+		if !strings.HasPrefix(hrp, prefix) {
+			continue
+		}
+
+		amount, err = parseAmount(strings.TrimPrefix(hrp, prefix))
+		return chains[prefix], amount, err
+	}
+
+	return c, nil, errors.Errorf("unknown network: %s", hrp)
+}
+
+func uintFromGroups(groups []byte) (v uint64, err error) {
+	if len(groups) > 12 {
+		return 0, errors.New("integer field too long")
+	}
+
+	for _, g := range groups {
+		v = v<<5 | uint64(g)
+	}
+
+	return
+}
+
+func bytesFromGroups(groups []byte) ([]byte, error) {
+	return bech32.ConvertBits(groups, 5, 8, false)
+}
+
+func parseFallback(c chain, groups []byte) (string, error) {
+	if len(groups) == 0 {
+		return "", errors.New("empty fallback address field")
+	}
+
+	version, program := groups[0], groups[1:]
+	data, err := bytesFromGroups(program)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid fallback address")
+	}
+
+	switch {
+	case version <= 16:
+		return bech32.EncodeSegWit(c.SegWitHrp, version, data)
+
+	case version == 17 && len(data) == 20:
+		return btc.Base58CheckEncode(c.P2PKH, data), nil
+
+	case version == 18 && len(data) == 20:
+		return btc.Base58CheckEncode(c.P2SH, data), nil
+	}
+
+	// unknown fallback versions are to be skipped
+	return "", nil
+}
+
+func parseRouteHint(b []byte) (hint []RouteHop, err error) {
+	if len(b) == 0 || len(b)%hopLen != 0 {
+		return nil, errors.Errorf("invalid route hint length: %d is not a multiple of %d", len(b), hopLen)
+	}
+
+	for ; len(b) > 0; b = b[hopLen:] {
+		hint = append(hint, RouteHop{
+			PubKey:                    hex.EncodeToString(b[:33]),
+			ShortChannelId:            formatShortChannelId(binary.BigEndian.Uint64(b[33:41])),
+			FeeBaseMsat:               binary.BigEndian.Uint32(b[41:45]),
+			FeeProportionalMillionths: binary.BigEndian.Uint32(b[45:49]),
+			CltvExpiryDelta:           binary.BigEndian.Uint16(b[49:51]),
+		})
+	}
+
+	return
+}
+
+func parseFeatures(groups []byte) (features []Feature) {
+	for i := range groups {
+		g := groups[len(groups)-1-i]
+		for bit := 0; bit < 5; bit++ {
+			if g&(1<<uint(bit)) != 0 {
+				features = append(features, newFeature(i*5+bit))
+			}
+		}
+	}
+
+	return
+}
+
+func parseTaggedFields(inv *Invoice, c chain, data []byte) (payee []byte, err error) {
+	for len(data) > 0 {
+		if len(data) < 3 {
+			return nil, errors.New("truncated tagged field")
+		}
+
+		tag, length := data[0], int(data[1])<<5|int(data[2])
+		data = data[3:]
+
+		if len(data) < length {
+			return nil, errors.Errorf("tagged field %d longer than the remaining data", tag)
+		}
+
+		groups := data[:length]
+		data = data[length:]
+
+		switch tag {
+		case tagPaymentHash, tagPaymentSecret, tagDescriptionHash:
+			// fields of unexpected length MUST be skipped
+			if length != hashLen {
+				continue
+			}
+
+			b, err := bytesFromGroups(groups)
+			if err != nil {
+				return nil, err
+			}
+
+			switch tag {
+			case tagPaymentHash:
+				if inv.PaymentHash == "" {
+					inv.PaymentHash = hex.EncodeToString(b)
+				}
+
+			case tagPaymentSecret:
+				if inv.PaymentSecret == "" {
+					inv.PaymentSecret = hex.EncodeToString(b)
+				}
+
+			case tagDescriptionHash:
+				if inv.DescriptionHash == "" {
+					inv.DescriptionHash = hex.EncodeToString(b)
+				}
+			}
+
+		case tagPayee:
+			if length != pubKeyLen {
+				continue
+			}
+
+			payee, err = bytesFromGroups(groups)
+			if err != nil {
+				return nil, err
+			}
+
+		case tagDescription:
+			b, err := bytesFromGroups(groups)
+			if err != nil {
+				return nil, err
+			}
+
+			if !utf8.Valid(b) {
+				return nil, errors.New("description is not a valid UTF-8 string")
+			}
+
+			description := string(b)
+			inv.Description = &description
+
+		case tagMetadata:
+			b, err := bytesFromGroups(groups)
+			if err != nil {
+				return nil, err
+			}
+
+			inv.Metadata = hex.EncodeToString(b)
+
+		case tagExpiry:
+			v, err := uintFromGroups(groups)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid expiry")
+			}
+
+			inv.Expiry = int64(v)
+
+		case tagMinFinalCltv:
+			inv.MinFinalCltvExpiry, err = uintFromGroups(groups)
+			if err != nil {
+				return nil, errors.Wrap(err, "invalid min_final_cltv_expiry")
+			}
+
+		case tagFallback:
+			addr, err := parseFallback(c, groups)
+			if err != nil {
+				return nil, err
+			}
+
+			if addr != "" {
+				inv.Fallbacks = append(inv.Fallbacks, addr)
+			}
+
+		case tagRouteHint:
+			b, err := bytesFromGroups(groups)
+			if err != nil {
+				return nil, err
+			}
+
+			hint, err := parseRouteHint(b)
+			if err != nil {
+				return nil, err
+			}
+
+			inv.RouteHints = append(inv.RouteHints, hint)
+
+		case tagFeatures:
+			inv.Features = parseFeatures(groups)
+		}
+
+		// all other fields are unknown, and are skipped
+	}
+
+	return
+}
+
+func verifySignature(hrp string, data, sigGroups []byte, payee []byte) (pubKey *btcec.PublicKey, err error) {
+	sig, err := bytesFromGroups(sigGroups)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+
+	toSign, err := bech32.ConvertBits(data, 5, 8, true)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(append([]byte(hrp), toSign...))
+
+	// explicitly provided payee takes precedence over public key recovery
+	if payee != nil {
+		pubKey, err = btcec.ParsePubKey(payee)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid payee public key")
+		}
+
+		var r, s btcec.ModNScalar
+		if r.SetByteSlice(sig[:32]) || s.SetByteSlice(sig[32:64]) {
+			return nil, errors.New("invalid signature")
+		}
+
+		if !ecdsa.NewSignature(&r, &s).Verify(hash[:], pubKey) {
+			return nil, errors.New("signature doesn't match payee public key")
+		}
+
+		return pubKey, nil
+	}
+
+	recoveryId := sig[64]
+	if recoveryId > 3 {
+		return nil, errors.Errorf("invalid signature recovery id: %d", recoveryId)
+	}
+
+	// compact signature format expected by btcec: [27 + recovery id + 4 (compressed)] || r || s
+	compact := append([]byte{27 + 4 + recoveryId}, sig[:64]...)
+	pubKey, _, err = ecdsa.RecoverCompact(compact, hash[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to recover payee public key")
+	}
+
+	return pubKey, nil
+}
+
+// DecodeInvoice parses a BOLT-11 invoice, and verifies its signature
+func DecodeInvoice(s string) (inv Invoice, err error) {
+	s = StripUri(s)
+
+	hrp, data, encoding, err := bech32.DecodeNoLimit(s)
+	if err != nil {
+		return inv, errors.Wrap(err, "invalid bech32 string")
+	}
+
+	if encoding != bech32.Bech32 {
+		return inv, errors.New("invoices must use bech32, not bech32m, checksum")
+	}
+
+	c, amount, err := parseHrp(hrp)
+	if err != nil {
+		return
+	}
+
+	if len(data) < timestampLen+signatureLen {
+		return inv, errors.New("invoice too short")
+	}
+
+	inv.Network = c.Name
+	inv.AmountMsat = amount
+	inv.Expiry = DefaultExpiry
+	inv.MinFinalCltvExpiry = DefaultMinFinalCltvExpiry
+
+	timestamp, _ := uintFromGroups(data[:timestampLen])
+	inv.Timestamp = int64(timestamp)
+
+	sigGroups := data[len(data)-signatureLen:]
+	data = data[:len(data)-signatureLen]
+
+	payee, err := parseTaggedFields(&inv, c, data[timestampLen:])
+	if err != nil {
+		return
+	}
+
+	if inv.PaymentHash == "" {
+		return inv, errors.New("missing payment hash")
+	}
+
+	if (inv.Description == nil) == (inv.DescriptionHash == "") {
+		return inv, errors.New("exactly one of description or description hash is required")
+	}
+
+	pubKey, err := verifySignature(hrp, data, sigGroups, payee)
+	if err != nil {
+		return
+	}
+
+	sig, _ := bytesFromGroups(sigGroups)
+	inv.Signature = hex.EncodeToString(sig[:64])
+	inv.Payee = hex.EncodeToString(pubKey.SerializeCompressed())
+
+	return inv, nil
+}
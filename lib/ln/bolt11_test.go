@@ -0,0 +1,249 @@
+package ln
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// test vectors come from BOLT-11 (https://github.com/lightning/bolts/blob/master/11-payment-encoding.md)
+const (
+	specPayee       = "03e7156ae33b0a208d0744199163177e909e80176e55d97a2f221ede0f934dd9ad"
+	specPaymentHash = "0001020304050607080900010203040506070809000102030405060708090102"
+	specDescHash    = "3925b6f67e2c340036ed12093dd44e0368df1b6ea26c53dbe4811f58fd5db8c1"
+
+	donation        = "lnbc1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdpl2pkx2ctnv5sxxmmwwd5kgetjypeh2ursdae8g6twvus8g6rfwvs8qun0dfjkxaq8rkx3yf5tcsyz3d73gafnh3cax9rn449d9p5uxz9ezhhypd0elx87sjle52x86fux2ypatgddc6k63n7erqz25le42c4u4ecky03ylcqca784w"
+	coffee          = "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jsxqzpuaztrnwngzn3kdzw5hydlzf03qdgm2hdq27cqv3agm2awhz5se903vruatfhq77w3ls4evs3ch9zw97j25emudupq63nyw24cg27h2rspfj9srp"
+	explicitPayee   = "lnbc241pveeq09pp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdqqnp4q0n326hr8v9zprg8gsvezcch06gfaqqhde2aj730yg0durunfhv66jd3m5klcwhq68vdsmx2rjgxeay5v0tkt2v5sjaky4eqahe4fx3k9sqavvce3capfuwv8rvjng57jrtfajn5dkpqv8yelsewtljwmmycq62k443"
+	testnetFallback = "lntb20m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqsfpp3x9et2e20v6pu37c5d9vax37wxq72un98k6vcx9fz94w0qf237cm2rqv9pmn5lnexfvf5579slr4zq3u8kmczecytdx0xg9rwzngp7e6guwqpqlhssu04sucpnz4axcv2dstmknqq6jsk2l"
+	routeHints      = "lnbc20m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqsfpp3qjmp7lwpagxun9pygexvgpjdc4jdj85fr9yq20q82gphp2nflc7jtzrcazrra7wwgzxqc8u7754cdlpfrmccae92qgzqvzq2ps8pqqqqqqpqqqqq9qqqvpeuqafqxu92d8lr6fvg0r5gv0heeeqgcrqlnm6jhphu9y00rrhy4grqszsvpcgpy9qqqqqqgqqqqq7qqzqj9n4evl6mr5aj9f58zp6fyjzup6ywn3x6sk8akg5v4tgn2q8g4fhx05wf6juaxu9760yp46454gpg5mtzgerlzezqcqvjnhjh8z3g2qqdhhwkj"
+	p2wshFallback   = "lnbc20m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqsfp4qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qvnjha2auylmwrltv2pkp2t22uy8ura2xsdwhq5nm7s574xva47djmnj2xeycsu7u5v8929mvuux43j0cqhhf32wfyn2th0sv4t9x55sppz5we8"
+	features        = "lnbc25m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5vdhkven9v5sxyetpdeessp5zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zyg3zygs9q5sqqqqqqqqqqqqqqqpqsq67gye39hfg3zd8rgc80k32tvy9xk2xunwm5lzexnvpx6fd77en8qaq424dxgt56cag2dpt359k3ssyhetktkpqh24jqnjyw6uqd08sgptq44qu"
+	customCltv      = "lnbc2500u1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdq5xysxxatsyp3k7enxv4jscqzysnp4q0n326hr8v9zprg8gsvezcch06gfaqqhde2aj730yg0durunfhv66ysxkvnxhcvhz48sn72lp77h4fxcur27z0he48u5qvk3sxse9mr9jhkltt962s8arjnzk8rk59yj5nw4p495747gksj30gza0crhzwjcpgxzy00"
+	regtest         = "lnbcrt241pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqdqqnp4q0n326hr8v9zprg8gsvezcch06gfaqqhde2aj730yg0durunfhv66df5c8pqjjt4z4ymmuaxfx8eh5v7hmzs3wrfas8m2sz5qz56rw2lxy8mmgm4xln0ha26qkw6u3vhu22pss2udugr9g74c3x20slpcqjgq0el4h6"
+
+	noPaymentHash = "lnbc20m1pvjluezhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqsjv38luh6p6s2xrv3mzvlmzaya43376h0twal5ax0k6p47498hp3hnaymzhsn424rxqjs0q7apn26yrhaxltq3vzwpqj9nc2r3kzwccsplnq470"
+	badRouteHint  = "lnbc20m1pvjluezpp5qqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqqqsyqcyq5rqwzqfqypqhp58yjmdan79s6qqdhdzgynm4zwqd5d7xmw5fk98klysy043l2ahrqsfpp3qjmp7lwpagxun9pygexvgpjdc4jdj85frqg00000000j9n4evl6mr5aj9f58zp6fyjzup6ywn3x6sk8akg5v4tgn2q8g4fhx05wf6juaxu9760yp46454gpg5mtzgerlzezqcqvjnhjh8z3g2qqsj5cgu"
+)
+
+func TestDecodeInvoice(t *testing.T) {
+	Convey("Given a donation invoice w/o an amount", t, func() {
+		inv, err := DecodeInvoice(donation)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Network should be mainnet", func() {
+			So(inv.Network, ShouldEqual, "mainnet")
+		})
+
+		Convey(".AmountMsat should be empty", func() {
+			So(inv.AmountMsat, ShouldBeNil)
+		})
+
+		Convey(".Timestamp should be set correctly", func() {
+			So(inv.Timestamp, ShouldEqual, 1496314658)
+		})
+
+		Convey(".PaymentHash should be set correctly", func() {
+			So(inv.PaymentHash, ShouldEqual, specPaymentHash)
+		})
+
+		Convey(".Description should be set correctly", func() {
+			So(*inv.Description, ShouldEqual, "Please consider supporting this project")
+		})
+
+		Convey(".Payee should be recovered from the signature", func() {
+			So(inv.Payee, ShouldEqual, specPayee)
+		})
+
+		Convey("default .Expiry and .MinFinalCltvExpiry should be used", func() {
+			So(inv.Expiry, ShouldEqual, DefaultExpiry)
+			So(inv.MinFinalCltvExpiry, ShouldEqual, DefaultMinFinalCltvExpiry)
+		})
+	})
+
+	Convey("Given a coffee invoice with a `lightning:` prefix, upper-cased", t, func() {
+		inv, err := DecodeInvoice("LIGHTNING:" + coffee)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".AmountMsat should be 2500u", func() {
+			So(*inv.AmountMsat, ShouldEqual, 250000000)
+		})
+
+		Convey(".Expiry should be set to 60s", func() {
+			So(inv.Expiry, ShouldEqual, 60)
+		})
+
+		Convey("it should only be expired after 60s", func() {
+			So(inv.IsExpired(time.Unix(1496314658+59, 0)), ShouldBeFalse)
+			So(inv.IsExpired(time.Unix(1496314658+60, 0)), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an invoice with an explicit payee & empty description", t, func() {
+		inv, err := DecodeInvoice(explicitPayee)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".AmountMsat should be 24 BTC", func() {
+			So(*inv.AmountMsat, ShouldEqual, 2400000000000)
+		})
+
+		Convey(".Payee should be set correctly", func() {
+			So(inv.Payee, ShouldEqual, specPayee)
+		})
+
+		Convey(".Description should be set, but empty", func() {
+			So(inv.Description, ShouldNotBeNil)
+			So(*inv.Description, ShouldBeEmpty)
+		})
+	})
+
+	Convey("Given a testnet invoice with a P2PKH fallback", t, func() {
+		inv, err := DecodeInvoice(testnetFallback)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Network should be testnet", func() {
+			So(inv.Network, ShouldEqual, "testnet")
+		})
+
+		Convey(".DescriptionHash should be set correctly", func() {
+			So(inv.DescriptionHash, ShouldEqual, specDescHash)
+		})
+
+		Convey(".Fallbacks should contain a testnet address", func() {
+			So(inv.Fallbacks, ShouldResemble, []string{"mk2QpYatsKicvFVuTAQLBryyccRXMUaGHP"})
+		})
+	})
+
+	Convey("Given an invoice with a P2WSH fallback", t, func() {
+		inv, err := DecodeInvoice(p2wshFallback)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Fallbacks should contain a bech32 address", func() {
+			So(inv.Fallbacks, ShouldResemble, []string{"bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3"})
+		})
+	})
+
+	Convey("Given an invoice with a two-hop route hint", t, func() {
+		inv, err := DecodeInvoice(routeHints)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Fallbacks should contain a P2PKH address", func() {
+			So(inv.Fallbacks, ShouldResemble, []string{"1RustyRX2oai4EYYDpQGWvEL62BBGqN9T"})
+		})
+
+		Convey(".RouteHints should be decoded correctly", func() {
+			So(inv.RouteHints, ShouldResemble, [][]RouteHop{{
+				{
+					PubKey:                    "029e03a901b85534ff1e92c43c74431f7ce72046060fcf7a95c37e148f78c77255",
+					ShortChannelId:            "66051x263430x1800",
+					FeeBaseMsat:               1,
+					FeeProportionalMillionths: 20,
+					CltvExpiryDelta:           3,
+				}, {
+					PubKey:                    "039e03a901b85534ff1e92c43c74431f7ce72046060fcf7a95c37e148f78c77255",
+					ShortChannelId:            "197637x395016x2314",
+					FeeBaseMsat:               2,
+					FeeProportionalMillionths: 30,
+					CltvExpiryDelta:           4,
+				},
+			}})
+		})
+	})
+
+	Convey("Given an invoice with a payment secret & features", t, func() {
+		inv, err := DecodeInvoice(features)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".PaymentSecret should be set correctly", func() {
+			So(inv.PaymentSecret, ShouldEqual, "1111111111111111111111111111111111111111111111111111111111111111")
+		})
+
+		Convey(".Features should list bits 9, 15 & 99", func() {
+			So(inv.Features, ShouldResemble, []Feature{
+				{9, "var_onion_optin", false},
+				{15, "payment_secret", false},
+				{99, "", false},
+			})
+		})
+	})
+
+	Convey("Given an invoice with a custom min_final_cltv_expiry", t, func() {
+		inv, err := DecodeInvoice(customCltv)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".MinFinalCltvExpiry should be 144", func() {
+			So(inv.MinFinalCltvExpiry, ShouldEqual, 144)
+		})
+	})
+
+	Convey("Given a regtest invoice", t, func() {
+		inv, err := DecodeInvoice(regtest)
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Network should be regtest", func() {
+			So(inv.Network, ShouldEqual, "regtest")
+		})
+	})
+}
+
+func TestDecodeInvalidInvoice(t *testing.T) {
+	Convey("Given an invoice w/o a payment hash", t, func() {
+		_, err := DecodeInvoice(noPaymentHash)
+
+		Convey("There should be an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an invoice with an invalid route hint length", t, func() {
+		_, err := DecodeInvoice(badRouteHint)
+
+		Convey("There should be an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an invoice with a modified amount", t, func() {
+		_, err := DecodeInvoice("lnbc2600u" + coffee[len("lnbc2500u"):])
+
+		Convey("There should be an error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given strings that aren't invoices", t, func() {
+		for _, s := range []string{"", "lnbc1abcde", "1asdsaddnv4wudz", "llts1dasdajtkfl6", "lnbcm1aaamcu25m"} {
+			_, err := DecodeInvoice(s)
+
+			So(err, ShouldNotBeNil)
+		}
+	})
+}
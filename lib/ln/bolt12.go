@@ -0,0 +1,779 @@
+package ln
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/meeDamian/bc1toolkit/lib/bech32"
+	"github.com/pkg/errors"
+)
+
+const (
+	OfferHrp          = "lno"
+	InvoiceRequestHrp = "lnr"
+	Bolt12InvoiceHrp  = "lni"
+
+	DefaultRelativeExpiry = 7200
+
+	signatureField = "signature"
+
+	invoiceRequestMessage = "invoice_request"
+	invoiceMessage        = "invoice"
+)
+
+// BOLT-12 TLV types
+const (
+	typeInvReqMetadata     = 0
+	typeOfferChains        = 2
+	typeOfferMetadata      = 4
+	typeOfferCurrency      = 6
+	typeOfferAmount        = 8
+	typeOfferDescription   = 10
+	typeOfferFeatures      = 12
+	typeOfferAbsExpiry     = 14
+	typeOfferPaths         = 16
+	typeOfferIssuer        = 18
+	typeOfferQuantityMax   = 20
+	typeOfferIssuerId      = 22
+	typeInvReqChain        = 80
+	typeInvReqAmount       = 82
+	typeInvReqFeatures     = 84
+	typeInvReqQuantity     = 86
+	typeInvReqPayerId      = 88
+	typeInvReqPayerNote    = 89
+	typeInvReqPaths        = 90
+	typeInvoicePaths       = 160
+	typeInvoiceBlindedPay  = 162
+	typeInvoiceCreatedAt   = 164
+	typeInvoiceRelExpiry   = 166
+	typeInvoicePaymentHash = 168
+	typeInvoiceAmount      = 170
+	typeInvoiceFallbacks   = 172
+	typeInvoiceFeatures    = 174
+	typeInvoiceNodeId      = 176
+	typeSignature          = 240
+
+	signatureTypeStart = 240
+	signatureTypeEnd   = 1000
+)
+
+type (
+	BlindedHop struct {
+		BlindedNodeId          string `json:"blinded_node_id"`
+		EncryptedRecipientData string `json:"encrypted_recipient_data"`
+	}
+
+	BlindedPath struct {
+		FirstNodeId         string       `json:"first_node_id,omitempty"`
+		FirstShortChannelId string       `json:"first_short_channel_id,omitempty"`
+		FirstDirection      *byte        `json:"first_direction,omitempty"`
+		FirstPathKey        string       `json:"first_path_key"`
+		Hops                []BlindedHop `json:"hops"`
+	}
+
+	BlindedPayInfo struct {
+		FeeBaseMsat               uint32    `json:"fee_base_msat"`
+		FeeProportionalMillionths uint32    `json:"fee_proportional_millionths"`
+		CltvExpiryDelta           uint16    `json:"cltv_expiry_delta"`
+		HtlcMinimumMsat           uint64    `json:"htlc_minimum_msat"`
+		HtlcMaximumMsat           uint64    `json:"htlc_maximum_msat"`
+		Features                  []Feature `json:"features,omitempty"`
+	}
+
+	Fallback struct {
+		Version byte   `json:"version"`
+		Address string `json:"address"`
+	}
+
+	// Offer uses names of BOLT-12 TLV fields as JSON keys
+	Offer struct {
+		Chains         []string      `json:"offer_chains,omitempty"`
+		Metadata       string        `json:"offer_metadata,omitempty"`
+		Currency       string        `json:"offer_currency,omitempty"`
+		Amount         *uint64       `json:"offer_amount,omitempty"`
+		Description    *string       `json:"offer_description,omitempty"`
+		Features       []Feature     `json:"offer_features,omitempty"`
+		AbsoluteExpiry *uint64       `json:"offer_absolute_expiry,omitempty"`
+		Paths          []BlindedPath `json:"offer_paths,omitempty"`
+		Issuer         *string       `json:"offer_issuer,omitempty"`
+		QuantityMax    *uint64       `json:"offer_quantity_max,omitempty"`
+		IssuerId       string        `json:"offer_issuer_id,omitempty"`
+
+		UnknownFields map[uint64]string `json:"unknown_fields,omitempty"`
+	}
+
+	InvoiceRequest struct {
+		Offer
+
+		Metadata  string        `json:"invreq_metadata"`
+		Chain     string        `json:"invreq_chain,omitempty"`
+		Amount    *uint64       `json:"invreq_amount,omitempty"`
+		Features  []Feature     `json:"invreq_features,omitempty"`
+		Quantity  *uint64       `json:"invreq_quantity,omitempty"`
+		PayerId   string        `json:"invreq_payer_id"`
+		PayerNote *string       `json:"invreq_payer_note,omitempty"`
+		Paths     []BlindedPath `json:"invreq_paths,omitempty"`
+
+		Signature string `json:"signature"`
+	}
+
+	Bolt12Invoice struct {
+		InvoiceRequest
+
+		Paths          []BlindedPath    `json:"invoice_paths"`
+		BlindedPay     []BlindedPayInfo `json:"invoice_blindedpay"`
+		CreatedAt      uint64           `json:"invoice_created_at"`
+		RelativeExpiry uint64           `json:"invoice_relative_expiry"`
+		PaymentHash    string           `json:"invoice_payment_hash"`
+		Amount         uint64           `json:"invoice_amount"`
+		Fallbacks      []Fallback       `json:"invoice_fallbacks,omitempty"`
+		Features       []Feature        `json:"invoice_features,omitempty"`
+		NodeId         string           `json:"invoice_node_id"`
+
+		Signature string `json:"signature"`
+	}
+)
+
+// BOLT-12 strings can be split with `+`, optionally followed by whitespace
+var joiner = regexp.MustCompile(`\+\s*`)
+
+func (o Offer) ExpiresAt() (time.Time, bool) {
+	if o.AbsoluteExpiry == nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(int64(*o.AbsoluteExpiry), 0), true
+}
+
+func (i Bolt12Invoice) ExpiresAt() (time.Time, bool) {
+	return time.Unix(int64(i.CreatedAt+i.RelativeExpiry), 0), true
+}
+
+// segWitHrp returns the address prefix of the chain invoice is for, mainnet if not specified
+func (ir InvoiceRequest) segWitHrp() string {
+	for _, c := range chains {
+		if c.Name == ir.Chain {
+			return c.SegWitHrp
+		}
+	}
+
+	return chains["bc"].SegWitHrp
+}
+
+func taggedHash(tag []byte, msg ...[]byte) []byte {
+	tagHash := sha256.Sum256(tag)
+
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, m := range msg {
+		h.Write(m)
+	}
+
+	return h.Sum(nil)
+}
+
+func merkleBranch(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+
+	return taggedHash([]byte("LnBranch"), a, b)
+}
+
+func isSignatureType(t uint64) bool {
+	return t >= signatureTypeStart && t <= signatureTypeEnd
+}
+
+// merkleRoot implements the signature calculation described in BOLT-12
+func merkleRoot(records []tlvRecord) []byte {
+	nonceTag := append([]byte("LnNonce"), records[0].Raw...)
+
+	var level [][]byte
+	for _, r := range records {
+		if isSignatureType(r.Type) {
+			continue
+		}
+
+		_, n, _ := readBigSize(r.Raw)
+		level = append(level, merkleBranch(
+			taggedHash([]byte("LnLeaf"), r.Raw),
+			taggedHash(nonceTag, r.Raw[:n]),
+		))
+	}
+
+	for len(level) > 1 {
+		var next [][]byte
+		for i := 0; i < len(level); i += 2 {
+			if i+1 == len(level) {
+				next = append(next, level[i])
+				continue
+			}
+
+			next = append(next, merkleBranch(level[i], level[i+1]))
+		}
+
+		level = next
+	}
+
+	return level[0]
+}
+
+func verifyBolt12Signature(records []tlvRecord, messageName string, sig, pubKey []byte) error {
+	if sig == nil {
+		return errors.New("missing signature")
+	}
+
+	if len(sig) != 64 {
+		return errors.Errorf("invalid signature length: %d", len(sig))
+	}
+
+	s, err := schnorr.ParseSignature(sig)
+	if err != nil {
+		return errors.Wrap(err, "invalid signature")
+	}
+
+	// BIP-340 uses x-only public keys
+	key, err := schnorr.ParsePubKey(pubKey[1:])
+	if err != nil {
+		return errors.Wrap(err, "invalid public key")
+	}
+
+	msg := taggedHash([]byte("lightning"+messageName+signatureField), merkleRoot(records))
+	if !s.Verify(msg, key) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func decodeBolt12String(s, expectedHrp string) ([]tlvRecord, error) {
+	s = joiner.ReplaceAllString(strings.TrimSpace(s), "")
+
+	hrp, data, err := bech32.DecodeNoChecksum(s)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bech32 string")
+	}
+
+	if hrp != expectedHrp {
+		return nil, errors.Errorf("unexpected prefix: %s instead of %s", hrp, expectedHrp)
+	}
+
+	b, err := bech32.ConvertBits(data, 5, 8, false)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid data")
+	}
+
+	records, err := parseTlvStream(b)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("empty TLV stream")
+	}
+
+	return records, nil
+}
+
+func parseUtf8(b []byte) (*string, error) {
+	if !utf8.Valid(b) {
+		return nil, errors.New("not a valid UTF-8 string")
+	}
+
+	s := string(b)
+	return &s, nil
+}
+
+func parseTu64(b []byte) (*uint64, error) {
+	v, err := readTruncated(b, 8)
+	if err != nil {
+		return nil, err
+	}
+
+	return &v, nil
+}
+
+func parseFeatureBytes(b []byte) (features []Feature) {
+	for i := range b {
+		c := b[len(b)-1-i]
+		for bit := 0; bit < 8; bit++ {
+			if c&(1<<uint(bit)) != 0 {
+				features = append(features, newFeature(i*8+bit))
+			}
+		}
+	}
+
+	return
+}
+
+func parseChainHash(b []byte) (string, error) {
+	if len(b) != 32 {
+		return "", errors.New("invalid chain hash length")
+	}
+
+	genesis := hex.EncodeToString(b)
+	for _, c := range chains {
+		if c.Genesis == genesis {
+			return c.Name, nil
+		}
+	}
+
+	return genesis, nil
+}
+
+func parseBlindedPaths(b []byte) (paths []BlindedPath, err error) {
+	r := &tlvReader{b: b}
+	for !r.done() {
+		var path BlindedPath
+
+		// first_node_id is either a point, or a 1-byte direction followed by a short channel id
+		switch first := r.take(1); {
+		case first == nil:
+
+		case first[0] == 0 || first[0] == 1:
+			direction := first[0]
+			path.FirstDirection = &direction
+			path.FirstShortChannelId = formatShortChannelId(r.u64())
+
+		case first[0] == 2 || first[0] == 3:
+			path.FirstNodeId = hex.EncodeToString(append(first, r.take(32)...))
+
+		default:
+			return nil, errors.Errorf("invalid first_node_id prefix: %#02x", first[0])
+		}
+
+		path.FirstPathKey = hex.EncodeToString(r.take(33))
+
+		numHops := r.take(1)
+		if numHops == nil || numHops[0] == 0 {
+			return nil, errors.New("blinded path w/o hops")
+		}
+
+		for i := 0; i < int(numHops[0]); i++ {
+			nodeId := r.take(33)
+			data := r.take(int(r.u16()))
+
+			path.Hops = append(path.Hops, BlindedHop{
+				BlindedNodeId:          hex.EncodeToString(nodeId),
+				EncryptedRecipientData: hex.EncodeToString(data),
+			})
+		}
+
+		paths = append(paths, path)
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "invalid blinded path")
+	}
+
+	return
+}
+
+func parseBlindedPayInfo(b []byte) (infos []BlindedPayInfo, err error) {
+	r := &tlvReader{b: b}
+	for !r.done() {
+		info := BlindedPayInfo{
+			FeeBaseMsat:               r.u32(),
+			FeeProportionalMillionths: r.u32(),
+			CltvExpiryDelta:           r.u16(),
+			HtlcMinimumMsat:           r.u64(),
+			HtlcMaximumMsat:           r.u64(),
+		}
+		info.Features = parseFeatureBytes(r.take(int(r.u16())))
+
+		infos = append(infos, info)
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "invalid blinded payinfo")
+	}
+
+	return
+}
+
+func parseFallbacks(segWitHrp string, b []byte) (fallbacks []Fallback, err error) {
+	r := &tlvReader{b: b}
+	for !r.done() {
+		version := r.take(1)
+		program := r.take(int(r.u16()))
+		if r.err != nil {
+			break
+		}
+
+		// only segwit versions can be represented as an address
+		if version[0] > 16 {
+			continue
+		}
+
+		addr, err := bech32.EncodeSegWit(segWitHrp, version[0], program)
+		if err != nil {
+			return nil, err
+		}
+
+		fallbacks = append(fallbacks, Fallback{version[0], addr})
+	}
+
+	if r.err != nil {
+		return nil, errors.Wrap(r.err, "invalid fallbacks")
+	}
+
+	return
+}
+
+// parseOfferField returns false if given record is not an offer field
+func parseOfferField(o *Offer, r tlvRecord) (ok bool, err error) {
+	v := r.Value
+
+	switch r.Type {
+	case typeOfferChains:
+		if len(v) == 0 || len(v)%32 != 0 {
+			return true, errors.New("invalid offer_chains length")
+		}
+
+		for ; len(v) > 0; v = v[32:] {
+			c, _ := parseChainHash(v[:32])
+			o.Chains = append(o.Chains, c)
+		}
+
+	case typeOfferMetadata:
+		o.Metadata = hex.EncodeToString(v)
+
+	case typeOfferCurrency:
+		if len(v) != 3 {
+			return true, errors.New("offer_currency is not an ISO 4217 code")
+		}
+
+		o.Currency = string(v)
+
+	case typeOfferAmount:
+		o.Amount, err = parseTu64(v)
+
+	case typeOfferDescription:
+		o.Description, err = parseUtf8(v)
+
+	case typeOfferFeatures:
+		o.Features = parseFeatureBytes(v)
+
+	case typeOfferAbsExpiry:
+		o.AbsoluteExpiry, err = parseTu64(v)
+
+	case typeOfferPaths:
+		o.Paths, err = parseBlindedPaths(v)
+		if err == nil && len(o.Paths) == 0 {
+			err = errors.New("offer_paths set, but empty")
+		}
+
+	case typeOfferIssuer:
+		o.Issuer, err = parseUtf8(v)
+
+	case typeOfferQuantityMax:
+		o.QuantityMax, err = parseTu64(v)
+
+	case typeOfferIssuerId:
+		var p []byte
+		p, err = readPoint(v)
+		o.IssuerId = hex.EncodeToString(p)
+
+	default:
+		return false, nil
+	}
+
+	return true, errors.Wrapf(err, "invalid TLV field %d", r.Type)
+}
+
+func (o *Offer) addUnknown(r tlvRecord) error {
+	// it's ok to be odd
+	if r.Type%2 == 0 {
+		return errors.Errorf("unknown even TLV field: %d", r.Type)
+	}
+
+	if o.UnknownFields == nil {
+		o.UnknownFields = make(map[uint64]string)
+	}
+
+	o.UnknownFields[r.Type] = hex.EncodeToString(r.Value)
+	return nil
+}
+
+func (o Offer) validate() error {
+	if o.Amount != nil && o.Description == nil {
+		return errors.New("offer_amount set w/o offer_description")
+	}
+
+	if o.Currency != "" && o.Amount == nil {
+		return errors.New("offer_currency set w/o offer_amount")
+	}
+
+	return nil
+}
+
+// DecodeOffer parses a BOLT-12 `lno…` offer
+func DecodeOffer(s string) (o Offer, err error) {
+	records, err := decodeBolt12String(s, OfferHrp)
+	if err != nil {
+		return
+	}
+
+	for _, r := range records {
+		ok, err := parseOfferField(&o, r)
+		if err != nil {
+			return o, err
+		}
+
+		if ok {
+			continue
+		}
+
+		if r.Type < 1 || r.Type > 79 && r.Type < 1000000000 || r.Type > 1999999999 {
+			return o, errors.Errorf("TLV field %d not allowed in an offer", r.Type)
+		}
+
+		err = o.addUnknown(r)
+		if err != nil {
+			return o, err
+		}
+	}
+
+	if o.IssuerId == "" && len(o.Paths) == 0 {
+		return o, errors.New("neither offer_issuer_id nor offer_paths set")
+	}
+
+	return o, o.validate()
+}
+
+// parseInvoiceRequestField returns false if given record is not an invoice_request field
+func parseInvoiceRequestField(ir *InvoiceRequest, r tlvRecord) (ok bool, err error) {
+	ok, err = parseOfferField(&ir.Offer, r)
+	if ok {
+		return
+	}
+
+	v := r.Value
+
+	switch r.Type {
+	case typeInvReqMetadata:
+		ir.Metadata = hex.EncodeToString(v)
+
+	case typeInvReqChain:
+		ir.Chain, err = parseChainHash(v)
+
+	case typeInvReqAmount:
+		ir.Amount, err = parseTu64(v)
+
+	case typeInvReqFeatures:
+		ir.Features = parseFeatureBytes(v)
+
+	case typeInvReqQuantity:
+		ir.Quantity, err = parseTu64(v)
+
+	case typeInvReqPayerId:
+		var p []byte
+		p, err = readPoint(v)
+		ir.PayerId = hex.EncodeToString(p)
+
+	case typeInvReqPayerNote:
+		ir.PayerNote, err = parseUtf8(v)
+
+	case typeInvReqPaths:
+		ir.Paths, err = parseBlindedPaths(v)
+
+	case typeSignature:
+		ir.Signature = hex.EncodeToString(v)
+
+	default:
+		return false, nil
+	}
+
+	return true, errors.Wrapf(err, "invalid TLV field %d", r.Type)
+}
+
+func signatureOf(records []tlvRecord) []byte {
+	for _, r := range records {
+		if r.Type == typeSignature {
+			return r.Value
+		}
+	}
+
+	return nil
+}
+
+// DecodeInvoiceRequest parses a BOLT-12 `lnr…` invoice_request, and verifies its signature
+func DecodeInvoiceRequest(s string) (ir InvoiceRequest, err error) {
+	records, err := decodeBolt12String(s, InvoiceRequestHrp)
+	if err != nil {
+		return
+	}
+
+	for _, r := range records {
+		ok, err := parseInvoiceRequestField(&ir, r)
+		if err != nil {
+			return ir, err
+		}
+
+		if ok {
+			continue
+		}
+
+		if r.Type > 159 && r.Type < 1000000000 && !isSignatureType(r.Type) || r.Type > 2999999999 {
+			return ir, errors.Errorf("TLV field %d not allowed in an invoice_request", r.Type)
+		}
+
+		err = ir.addUnknown(r)
+		if err != nil {
+			return ir, err
+		}
+	}
+
+	if ir.Metadata == "" {
+		return ir, errors.New("missing invreq_metadata")
+	}
+
+	if ir.PayerId == "" {
+		return ir, errors.New("missing invreq_payer_id")
+	}
+
+	// w/o an offer, amount is mandatory
+	if ir.IssuerId == "" && len(ir.Offer.Paths) == 0 && ir.Amount == nil {
+		return ir, errors.New("missing invreq_amount")
+	}
+
+	payerId, _ := hex.DecodeString(ir.PayerId)
+	err = verifyBolt12Signature(records, invoiceRequestMessage, signatureOf(records), payerId)
+	if err != nil {
+		return
+	}
+
+	return ir, ir.Offer.validate()
+}
+
+// DecodeBolt12Invoice parses a BOLT-12 `lni…` invoice, and verifies its signature
+func DecodeBolt12Invoice(s string) (inv Bolt12Invoice, err error) {
+	records, err := decodeBolt12String(s, Bolt12InvoiceHrp)
+	if err != nil {
+		return
+	}
+
+	inv.RelativeExpiry = DefaultRelativeExpiry
+
+	var hasCreatedAt, hasAmount bool
+	for _, r := range records {
+		if r.Type == typeSignature {
+			inv.Signature = hex.EncodeToString(r.Value)
+			continue
+		}
+
+		ok, err := parseInvoiceRequestField(&inv.InvoiceRequest, r)
+		if err != nil {
+			return inv, err
+		}
+
+		if ok {
+			continue
+		}
+
+		v := r.Value
+
+		switch r.Type {
+		case typeInvoicePaths:
+			inv.Paths, err = parseBlindedPaths(v)
+
+		case typeInvoiceBlindedPay:
+			inv.BlindedPay, err = parseBlindedPayInfo(v)
+
+		case typeInvoiceCreatedAt:
+			hasCreatedAt = true
+			inv.CreatedAt, err = readTruncated(v, 8)
+
+		case typeInvoiceRelExpiry:
+			inv.RelativeExpiry, err = readTruncated(v, 4)
+
+		case typeInvoicePaymentHash:
+			if len(v) != 32 {
+				err = errors.New("invalid payment hash length")
+			}
+
+			inv.PaymentHash = hex.EncodeToString(v)
+
+		case typeInvoiceAmount:
+			hasAmount = true
+			inv.Amount, err = readTruncated(v, 8)
+
+		case typeInvoiceFallbacks:
+			inv.Fallbacks, err = parseFallbacks(inv.segWitHrp(), v)
+
+		case typeInvoiceFeatures:
+			inv.Features = parseFeatureBytes(v)
+
+		case typeInvoiceNodeId:
+			var p []byte
+			p, err = readPoint(v)
+			inv.NodeId = hex.EncodeToString(p)
+
+		default:
+			if r.Type > 239 && r.Type < 1000000000 && !isSignatureType(r.Type) || r.Type > 2999999999 {
+				return inv, errors.Errorf("TLV field %d not allowed in an invoice", r.Type)
+			}
+
+			err = inv.addUnknown(r)
+		}
+
+		if err != nil {
+			return inv, errors.Wrapf(err, "invalid TLV field %d", r.Type)
+		}
+	}
+
+	switch {
+	case len(inv.Paths) == 0:
+		return inv, errors.New("missing invoice_paths")
+
+	case len(inv.Paths) != len(inv.BlindedPay):
+		return inv, errors.New("invoice_blindedpay doesn't match invoice_paths")
+
+	case !hasCreatedAt:
+		return inv, errors.New("missing invoice_created_at")
+
+	case inv.PaymentHash == "":
+		return inv, errors.New("missing invoice_payment_hash")
+
+	case !hasAmount:
+		return inv, errors.New("missing invoice_amount")
+
+	case inv.NodeId == "":
+		return inv, errors.New("missing invoice_node_id")
+	}
+
+	nodeId, _ := hex.DecodeString(inv.NodeId)
+	sig, _ := hex.DecodeString(inv.Signature)
+	if inv.Signature == "" {
+		sig = nil
+	}
+
+	err = verifyBolt12Signature(records, invoiceMessage, sig, nodeId)
+	return
+}
+
+// Decode parses any supported Lightning Network string: BOLT-11 invoice, or BOLT-12 offer, invoice_request or invoice.
+// Returned value is one of: Invoice, Offer, InvoiceRequest or Bolt12Invoice.
+func Decode(s string) (interface{}, error) {
+	s = StripUri(s)
+
+	switch {
+	case strings.HasPrefix(s, OfferHrp+"1"):
+		return DecodeOffer(s)
+
+	case strings.HasPrefix(s, InvoiceRequestHrp+"1"):
+		return DecodeInvoiceRequest(s)
+
+	case strings.HasPrefix(s, Bolt12InvoiceHrp+"1"):
+		return DecodeBolt12Invoice(s)
+	}
+
+	return DecodeInvoice(s)
+}
@@ -0,0 +1,434 @@
+package ln
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/meeDamian/bc1toolkit/lib/bech32"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	// offer with nothing but a description ("Test vectors")
+	descriptionOnlyOffer = "lno1pgx9getnwss8vetrw3hhyuc"
+
+	// invoice_request from the BOLT-12 signature test vectors, signed by payer with secret key 0x4242…42
+	specInvoiceRequest = "lnr1qqyqqqqqqqqqqqqqqcp4256ypqqkgzshgysy6ct5dpjk6ct5d93kzmpq23ex2ct5d9ek293pqthvwfzadd7jejes8q9lhc4rvjxd022zv5l44g6qah82ru5rdpnpjkppqvjx204vgdzgsqpvcp4mldl3plscny0rt707gvpdh6ndydfacz43euzqhrurageg3n7kafgsek6gz3e9w52parv8gs2hlxzk95tzeswywffxlkeyhml0hh46kndmwf4m6xma3tkq2lu04qz3slje2rfthc89vss"
+)
+
+type testTlv struct {
+	typ   uint64
+	value []byte
+}
+
+func tlvBytes(records ...testTlv) []byte {
+	var b bytes.Buffer
+	for _, r := range records {
+		b.Write(bigSizeBytes(r.typ))
+		b.Write(bigSizeBytes(uint64(len(r.value))))
+		b.Write(r.value)
+	}
+
+	return b.Bytes()
+}
+
+func bigSizeBytes(v uint64) []byte {
+	switch {
+	case v < 0xfd:
+		return []byte{byte(v)}
+
+	case v <= 0xffff:
+		return []byte{0xfd, byte(v >> 8), byte(v)}
+	}
+
+	return []byte{0xfe, byte(v >> 24), byte(v >> 16), byte(v >> 8), byte(v)}
+}
+
+func bolt12String(hrp string, b []byte) string {
+	const charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+	groups, _ := bech32.ConvertBits(b, 8, 5, true)
+
+	s := []byte(hrp + "1")
+	for _, g := range groups {
+		s = append(s, charset[g])
+	}
+
+	return string(s)
+}
+
+// signed appends a valid signature to the TLV stream made of records
+func signed(key *btcec.PrivateKey, messageName string, records ...testTlv) []byte {
+	stream, _ := parseTlvStream(tlvBytes(records...))
+	msg := taggedHash([]byte("lightning"+messageName+signatureField), merkleRoot(stream))
+
+	sig, _ := schnorr.Sign(key, msg)
+	return tlvBytes(append(records, testTlv{typeSignature, sig.Serialize()})...)
+}
+
+func TestTlvStream(t *testing.T) {
+	Convey("Given TLV streams", t, func() {
+		Convey("a valid one should be parsed", func() {
+			records, err := parseTlvStream([]byte{0x01, 0x02, 0x03, 0xe8, 0xfd, 0x01, 0x00, 0x00})
+			So(err, ShouldBeNil)
+			So(records, ShouldHaveLength, 2)
+			So(records[0].Type, ShouldEqual, 1)
+			So(records[0].Value, ShouldResemble, []byte{0x03, 0xe8})
+			So(records[1].Type, ShouldEqual, 256)
+			So(records[1].Value, ShouldBeEmpty)
+		})
+
+		Convey("not strictly increasing types should be rejected", func() {
+			_, err := parseTlvStream([]byte{0x02, 0x00, 0x01, 0x00})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("non-minimal BigSize should be rejected", func() {
+			_, err := parseTlvStream([]byte{0xfd, 0x00, 0x01, 0x00})
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("truncated value should be rejected", func() {
+			_, err := parseTlvStream([]byte{0x01, 0x05, 0x00})
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given truncated integers", t, func() {
+		v, err := readTruncated([]byte{0x03, 0xe8}, 8)
+		So(err, ShouldBeNil)
+		So(v, ShouldEqual, 1000)
+
+		_, err = readTruncated([]byte{0x00, 0x01}, 8)
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestMerkleRoot(t *testing.T) {
+	Convey("Given a single-field TLV stream from the BOLT-12 signature test vectors", t, func() {
+		records, _ := parseTlvStream([]byte{0x01, 0x02, 0x03, 0xe8})
+
+		So(hex.EncodeToString(merkleRoot(records)), ShouldEqual, "b013756c8fee86503a0b4abdab4cddeb1af5d344ca6fc2fa8b6c08938caa6f93")
+	})
+
+	Convey("Given the invoice_request from the BOLT-12 signature test vectors", t, func() {
+		records, err := decodeBolt12String(specInvoiceRequest, InvoiceRequestHrp)
+		So(err, ShouldBeNil)
+
+		So(hex.EncodeToString(merkleRoot(records)), ShouldEqual, "608407c18ad9a94d9ea2bcdbe170b6c20c462a7833a197621c916f78cf18e624")
+	})
+
+	Convey("Given a stream with a signature", t, func() {
+		records, _ := parseTlvStream(tlvBytes(
+			testTlv{1, []byte{1}},
+			testTlv{3, []byte{3}},
+			testTlv{5, []byte{5}},
+		))
+		withSig, _ := parseTlvStream(tlvBytes(
+			testTlv{1, []byte{1}},
+			testTlv{3, []byte{3}},
+			testTlv{5, []byte{5}},
+			testTlv{typeSignature, make([]byte, 64)},
+		))
+
+		Convey("signature fields should not affect the root", func() {
+			So(merkleRoot(withSig), ShouldResemble, merkleRoot(records))
+		})
+	})
+
+	Convey("Branches should not depend on order of their leaves", t, func() {
+		a := bytes.Repeat([]byte{0x0a}, 32)
+		b := bytes.Repeat([]byte{0xa0}, 32)
+
+		So(merkleBranch(a, b), ShouldResemble, merkleBranch(b, a))
+		So(merkleBranch(a, b), ShouldResemble, taggedHash([]byte("LnBranch"), a, b))
+	})
+}
+
+func TestDecodeOffer(t *testing.T) {
+	Convey("Given an offer w/o issuer_id nor paths", t, func() {
+		_, err := DecodeOffer(descriptionOnlyOffer)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "offer_issuer_id")
+	})
+
+	Convey("Given a minimal offer split with `+`", t, func() {
+		key, _ := btcec.NewPrivateKey()
+		offer := bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferDescription, []byte("Test vectors")},
+			testTlv{typeOfferIssuerId, key.PubKey().SerializeCompressed()},
+		))
+
+		o, err := DecodeOffer(offer[:20] + "+\n  " + offer[20:])
+
+		Convey("There should be no error", func() {
+			So(err, ShouldBeNil)
+		})
+
+		Convey(".Description should be set", func() {
+			So(*o.Description, ShouldEqual, "Test vectors")
+		})
+
+		Convey("it should never expire", func() {
+			_, ok := o.ExpiresAt()
+			So(ok, ShouldBeFalse)
+		})
+	})
+
+	Convey("Given an offer with amount & an unknown odd field", t, func() {
+		key, _ := btcec.NewPrivateKey()
+		o, err := DecodeOffer(bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferChains, mustHex(chains["tb"].Genesis)},
+			testTlv{typeOfferAmount, []byte{0x03, 0xe8}},
+			testTlv{typeOfferDescription, []byte("coffee")},
+			testTlv{typeOfferAbsExpiry, []byte{0x5f, 0x5e, 0x10, 0x00}},
+			testTlv{typeOfferIssuerId, key.PubKey().SerializeCompressed()},
+			testTlv{33, []byte{0xab}},
+		)))
+
+		So(err, ShouldBeNil)
+		So(o.Chains, ShouldResemble, []string{"testnet"})
+		So(*o.Amount, ShouldEqual, 1000)
+		So(o.IssuerId, ShouldEqual, hex.EncodeToString(key.PubKey().SerializeCompressed()))
+		So(o.UnknownFields, ShouldResemble, map[uint64]string{33: "ab"})
+
+		expiresAt, ok := o.ExpiresAt()
+		So(ok, ShouldBeTrue)
+		So(expiresAt.Unix(), ShouldEqual, 0x5f5e1000)
+	})
+
+	Convey("Given an offer with an unknown even field", t, func() {
+		_, err := DecodeOffer(bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferDescription, []byte("x")},
+			testTlv{32, []byte{0xab}},
+		)))
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given an offer with amount, but w/o description", t, func() {
+		key, _ := btcec.NewPrivateKey()
+		_, err := DecodeOffer(bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferAmount, []byte{0x01}},
+			testTlv{typeOfferIssuerId, key.PubKey().SerializeCompressed()},
+		)))
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given an offer with a blinded path", t, func() {
+		key, _ := btcec.NewPrivateKey()
+		pub := key.PubKey().SerializeCompressed()
+
+		var path []byte
+		path = append(path, 0x01, 0, 0, 0x01, 0, 0, 0x02, 0, 0x03) // sciddir: direction + 1x2x3
+		path = append(path, pub...)                                // first_path_key
+		path = append(path, 0x01)                                  // num_hops
+		path = append(path, pub...)                                // blinded_node_id
+		path = append(path, 0x00, 0x02, 0xaa, 0xbb)                // encrypted_recipient_data
+
+		o, err := DecodeOffer(bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferDescription, []byte("x")},
+			testTlv{typeOfferPaths, path},
+		)))
+
+		So(err, ShouldBeNil)
+		So(o.Paths, ShouldHaveLength, 1)
+		So(o.Paths[0].FirstShortChannelId, ShouldEqual, "1x2x3")
+		So(*o.Paths[0].FirstDirection, ShouldEqual, 1)
+		So(o.Paths[0].Hops[0].EncryptedRecipientData, ShouldEqual, "aabb")
+	})
+
+	Convey("Given an offer with a blinded path starting with neither a point, nor sciddir", t, func() {
+		key, _ := btcec.NewPrivateKey()
+		pub := key.PubKey().SerializeCompressed()
+
+		var path []byte
+		path = append(path, 0x04)
+		path = append(path, pub[1:]...)
+		path = append(path, pub...)
+		path = append(path, 0x01)
+		path = append(path, pub...)
+		path = append(path, 0x00, 0x00)
+
+		_, err := DecodeOffer(bolt12String(OfferHrp, tlvBytes(
+			testTlv{typeOfferDescription, []byte("x")},
+			testTlv{typeOfferPaths, path},
+		)))
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "first_node_id")
+	})
+}
+
+func TestDecodeInvoiceRequest(t *testing.T) {
+	payer, _ := btcec.NewPrivateKey()
+	issuer, _ := btcec.NewPrivateKey()
+
+	records := []testTlv{
+		{typeInvReqMetadata, []byte{0xde, 0xad}},
+		{typeOfferDescription, []byte("coffee")},
+		{typeOfferIssuerId, issuer.PubKey().SerializeCompressed()},
+		{typeInvReqAmount, []byte{0x03, 0xe8}},
+		{typeInvReqPayerId, payer.PubKey().SerializeCompressed()},
+		{typeInvReqPayerNote, []byte("thanks")},
+	}
+
+	Convey("Given the invoice_request from the BOLT-12 signature test vectors", t, func() {
+		ir, err := DecodeInvoiceRequest(specInvoiceRequest)
+
+		So(err, ShouldBeNil)
+		So(ir.Metadata, ShouldEqual, "0000000000000000")
+		So(*ir.Description, ShouldEqual, "A Mathematical Treatise")
+		So(*ir.Offer.Amount, ShouldEqual, 100)
+		So(ir.Currency, ShouldEqual, "USD")
+		So(ir.IssuerId, ShouldEqual, "02eec7245d6b7d2ccb30380bfbe2a3648cd7a942653f5aa340edcea1f283686619")
+		So(ir.PayerId, ShouldEqual, "0324653eac434488002cc06bbfb7f10fe18991e35f9fe4302dbea6d2353dc0ab1c")
+		So(ir.Signature, ShouldEqual, "b8f83ea3288cfd6ea510cdb481472575141e8d8744157f98562d162cc1c472526fdb24befefbdebab4dbb726bbd1b7d8aec057f8fa805187e5950d2bbe0e5642")
+
+		Convey("its signature should not verify as an invoice's", func() {
+			records, _ := decodeBolt12String(specInvoiceRequest, InvoiceRequestHrp)
+			payerId, _ := hex.DecodeString(ir.PayerId)
+
+			So(verifyBolt12Signature(records, invoiceMessage, signatureOf(records), payerId), ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a signed invoice_request", t, func() {
+		ir, err := DecodeInvoiceRequest(bolt12String(InvoiceRequestHrp, signed(payer, invoiceRequestMessage, records...)))
+
+		So(err, ShouldBeNil)
+		So(ir.Metadata, ShouldEqual, "dead")
+		So(*ir.Description, ShouldEqual, "coffee")
+		So(*ir.Amount, ShouldEqual, 1000)
+		So(*ir.PayerNote, ShouldEqual, "thanks")
+		So(ir.PayerId, ShouldEqual, hex.EncodeToString(payer.PubKey().SerializeCompressed()))
+	})
+
+	Convey("Given an invoice_request signed with a wrong key", t, func() {
+		_, err := DecodeInvoiceRequest(bolt12String(InvoiceRequestHrp, signed(issuer, invoiceRequestMessage, records...)))
+
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given an unsigned invoice_request", t, func() {
+		_, err := DecodeInvoiceRequest(bolt12String(InvoiceRequestHrp, tlvBytes(records...)))
+
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestDecodeBolt12Invoice(t *testing.T) {
+	node, _ := btcec.NewPrivateKey()
+	payer, _ := btcec.NewPrivateKey()
+	pub := node.PubKey().SerializeCompressed()
+
+	var path []byte
+	path = append(path, pub...)           // first_node_id
+	path = append(path, pub...)           // first_path_key
+	path = append(path, 0x01)             // num_hops
+	path = append(path, pub...)           // blinded_node_id
+	path = append(path, 0x00, 0x01, 0xff) // encrypted_recipient_data
+
+	payInfo := []byte{
+		0, 0, 0, 1, // fee_base_msat
+		0, 0, 0, 2, // fee_proportional_millionths
+		0, 3, // cltv_expiry_delta
+		0, 0, 0, 0, 0, 0, 0, 4, // htlc_minimum_msat
+		0, 0, 0, 0, 0, 0, 0, 5, // htlc_maximum_msat
+		0, 0, // features
+	}
+
+	records := []testTlv{
+		{typeInvReqMetadata, []byte{0x01}},
+		{typeOfferDescription, []byte("coffee")},
+		{typeOfferIssuerId, pub},
+		{typeInvReqPayerId, payer.PubKey().SerializeCompressed()},
+		{typeInvoicePaths, path},
+		{typeInvoiceBlindedPay, payInfo},
+		{typeInvoiceCreatedAt, []byte{0x5f, 0x5e, 0x10, 0x00}},
+		{typeInvoicePaymentHash, mustHex(specPaymentHash)},
+		{typeInvoiceAmount, []byte{0x03, 0xe8}},
+		{typeInvoiceFallbacks, append([]byte{0x00, 0x00, 0x14}, make([]byte, 20)...)},
+		{typeInvoiceNodeId, pub},
+	}
+
+	Convey("Given a signed BOLT-12 invoice", t, func() {
+		inv, err := Decode(bolt12String(Bolt12InvoiceHrp, signed(node, invoiceMessage, records...)))
+
+		So(err, ShouldBeNil)
+		So(inv, ShouldHaveSameTypeAs, Bolt12Invoice{})
+
+		i := inv.(Bolt12Invoice)
+		So(i.Amount, ShouldEqual, 1000)
+		So(i.PaymentHash, ShouldEqual, specPaymentHash)
+		So(i.NodeId, ShouldEqual, hex.EncodeToString(pub))
+		So(i.BlindedPay[0].CltvExpiryDelta, ShouldEqual, 3)
+		So(i.BlindedPay[0].HtlcMaximumMsat, ShouldEqual, 5)
+		So(i.Fallbacks[0].Address, ShouldEqual, "bc1qqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqqq9e75rs")
+		So(i.Signature, ShouldNotBeEmpty)
+
+		Convey("default relative expiry should be used", func() {
+			expiresAt, _ := i.ExpiresAt()
+			So(expiresAt.Unix(), ShouldEqual, 0x5f5e1000+DefaultRelativeExpiry)
+		})
+	})
+
+	Convey("Given an invoice w/o blinded payinfo", t, func() {
+		var partial []testTlv
+		for _, r := range records {
+			if r.typ != typeInvoiceBlindedPay {
+				partial = append(partial, r)
+			}
+		}
+
+		_, err := DecodeBolt12Invoice(bolt12String(Bolt12InvoiceHrp, signed(node, invoiceMessage, partial...)))
+		So(err, ShouldNotBeNil)
+	})
+
+	Convey("Given an invoice with unknown fields in the invoice range", t, func() {
+		withUnknown := func(typ uint64) []testTlv {
+			var out []testTlv
+			for _, r := range records {
+				out = append(out, r)
+				if r.typ == typeInvoiceNodeId {
+					out = append(out, testTlv{typ, []byte{0xab}})
+				}
+			}
+
+			return out
+		}
+
+		Convey("odd ones should be accepted", func() {
+			for _, typ := range []uint64{177, 201, 239} {
+				inv, err := DecodeBolt12Invoice(bolt12String(Bolt12InvoiceHrp, signed(node, invoiceMessage, withUnknown(typ)...)))
+
+				So(err, ShouldBeNil)
+				So(inv.UnknownFields, ShouldResemble, map[uint64]string{typ: "ab"})
+			}
+		})
+
+		Convey("even ones should be rejected", func() {
+			_, err := DecodeBolt12Invoice(bolt12String(Bolt12InvoiceHrp, signed(node, invoiceMessage, withUnknown(178)...)))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given an invoice signed as an invoice_request", t, func() {
+		_, err := DecodeBolt12Invoice(bolt12String(Bolt12InvoiceHrp, signed(node, invoiceRequestMessage, records...)))
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
@@ -0,0 +1,164 @@
+package ln
+
+import (
+	"encoding/binary"
+
+	"github.com/pkg/errors"
+)
+
+type (
+	tlvRecord struct {
+		Type  uint64
+		Value []byte
+
+		// raw bytes of the whole record (type, length & value), needed for merkle leaves
+		Raw []byte
+	}
+
+	tlvReader struct {
+		b   []byte
+		err error
+	}
+)
+
+func readBigSize(b []byte) (v uint64, n int, err error) {
+	if len(b) < 1 {
+		return 0, 0, errors.New("unexpected end of BigSize")
+	}
+
+	switch b[0] {
+	case 0xfd:
+		n = 3
+	case 0xfe:
+		n = 5
+	case 0xff:
+		n = 9
+	default:
+		return uint64(b[0]), 1, nil
+	}
+
+	if len(b) < n {
+		return 0, 0, errors.New("unexpected end of BigSize")
+	}
+
+	var min uint64
+	switch n {
+	case 3:
+		v, min = uint64(binary.BigEndian.Uint16(b[1:3])), 0xfd
+	case 5:
+		v, min = uint64(binary.BigEndian.Uint32(b[1:5])), 0x10000
+	case 9:
+		v, min = binary.BigEndian.Uint64(b[1:9]), 0x100000000
+	}
+
+	if v < min {
+		return 0, 0, errors.New("BigSize not minimally encoded")
+	}
+
+	return v, n, nil
+}
+
+func parseTlvStream(b []byte) (records []tlvRecord, err error) {
+	var last uint64
+	for i := 0; len(b) > 0; i++ {
+		typ, n, err := readBigSize(b)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid TLV type")
+		}
+
+		length, m, err := readBigSize(b[n:])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid TLV length of type %d", typ)
+		}
+
+		if uint64(len(b)-n-m) < length {
+			return nil, errors.Errorf("TLV type %d longer than remaining data", typ)
+		}
+
+		if i > 0 && typ <= last {
+			return nil, errors.Errorf("TLV types not strictly increasing: %d after %d", typ, last)
+		}
+
+		end := n + m + int(length)
+		records = append(records, tlvRecord{
+			Type:  typ,
+			Value: b[n+m : end],
+			Raw:   b[:end],
+		})
+
+		last, b = typ, b[end:]
+	}
+
+	return
+}
+
+func (r *tlvReader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+
+	if len(r.b) < n {
+		r.err = errors.New("unexpected end of TLV value")
+		return nil
+	}
+
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *tlvReader) u16() uint16 {
+	b := r.take(2)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint16(b)
+}
+
+func (r *tlvReader) u32() uint32 {
+	b := r.take(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *tlvReader) u64() uint64 {
+	b := r.take(8)
+	if b == nil {
+		return 0
+	}
+
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *tlvReader) done() bool {
+	return len(r.b) == 0 || r.err != nil
+}
+
+// truncated integers (tu16, tu32, tu64) omit leading zero bytes
+func readTruncated(b []byte, max int) (v uint64, err error) {
+	if len(b) > max {
+		return 0, errors.Errorf("truncated integer longer than %d bytes", max)
+	}
+
+	if len(b) > 0 && b[0] == 0 {
+		return 0, errors.New("truncated integer not minimally encoded")
+	}
+
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+
+	return
+}
+
+func readPoint(b []byte) ([]byte, error) {
+	if len(b) != 33 || (b[0] != 2 && b[0] != 3) {
+		return nil, errors.New("invalid point")
+	}
+
+	return b, nil
+}
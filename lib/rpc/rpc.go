@@ -0,0 +1,300 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/btc"
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	DefaultPort = "8332"
+
+	// CodeNotFound is returned by Core, ex. for blocks it doesn't know (RPC_INVALID_ADDRESS_OR_KEY)
+	CodeNotFound = -5
+
+	// responses are small, unless something is very wrong
+	maxResponseLength = 1 << 20
+)
+
+type (
+	// Node is what's known about Bitcoin Core after a single probe of its RPC
+	Node struct {
+		Address              string   `json:"address"`
+		UserAgent            string   `json:"useragent"`
+		Version              int      `json:"version"`
+		Protocol             int      `json:"protocol"`
+		Services             uint64   `json:"services"`
+		Chain                string   `json:"chain"`
+		LastBlock            int      `json:"lastblock"`
+		Headers              int      `json:"headers"`
+		InitialBlockDownload bool     `json:"ibd"`
+		VerificationProgress float64  `json:"verification_progress"`
+		Pruned               bool     `json:"pruned"`
+		Peers                int      `json:"peers"`
+		MempoolSize          int      `json:"mempool_size"`
+		MempoolBytes         int      `json:"mempool_bytes"`
+		Warnings             []string `json:"warnings,omitempty"`
+		TestNet              bool     `json:"testnet"`
+
+		// Latency is how long it took to connect, and get the first response
+		Latency time.Duration `json:"-"`
+	}
+
+	request struct {
+		JsonRpc string        `json:"jsonrpc"`
+		Id      string        `json:"id"`
+		Method  string        `json:"method"`
+		Params  []interface{} `json:"params"`
+	}
+
+	response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+
+	// Error is returned by Call(), when node responds with one
+	Error struct {
+		Method  string
+		Code    int
+		Message string
+	}
+
+	// warnings are a string before Core v28, and a list since
+	warnings []string
+
+	blockchainInfo struct {
+		Chain                string   `json:"chain"`
+		Blocks               int      `json:"blocks"`
+		Headers              int      `json:"headers"`
+		InitialBlockDownload bool     `json:"initialblockdownload"`
+		VerificationProgress float64  `json:"verificationprogress"`
+		Pruned               bool     `json:"pruned"`
+		Warnings             warnings `json:"warnings"`
+	}
+
+	networkInfo struct {
+		Version         int      `json:"version"`
+		SubVersion      string   `json:"subversion"`
+		ProtocolVersion int      `json:"protocolversion"`
+		LocalServices   string   `json:"localservices"`
+		Connections     int      `json:"connections"`
+		Warnings        warnings `json:"warnings"`
+	}
+
+	mempoolInfo struct {
+		Size  int `json:"size"`
+		Bytes int `json:"bytes"`
+	}
+
+	// Client calls RPCs of a single node
+	Client struct {
+		http           *http.Client
+		transport      *http.Transport
+		url            string
+		user, password string
+	}
+)
+
+func (w *warnings) UnmarshalJSON(b []byte) error {
+	var list []string
+	if json.Unmarshal(b, &list) == nil {
+		*w = list
+		return nil
+	}
+
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+
+	if s != "" {
+		*w = []string{s}
+	}
+
+	return nil
+}
+
+// ReadCookie returns credentials from the `.cookie` file Bitcoin Core creates in its data directory on each start
+func ReadCookie(path string) (user, password string, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", "", errors.Wrap(err, "unable to read RPC cookie")
+	}
+
+	chunks := strings.SplitN(strings.TrimSpace(string(b)), ":", 2)
+	if len(chunks) != 2 {
+		return "", "", errors.Errorf("invalid RPC cookie: %s", path)
+	}
+
+	return chunks[0], chunks[1], nil
+}
+
+// NewClient returns client of node at addr, with either credentials of addr, or user & password provided (ex. from a
+// cookie).  All calls share a single connection, that stays open until Close().
+func NewClient(dialer proxy.Dialer, addr connstring.ConnString, user, password string, timeout time.Duration) *Client {
+	if addr.Port == "" {
+		addr.Port = DefaultPort
+	}
+
+	if addr.User != nil {
+		user = addr.User.Username()
+		password, _ = addr.User.Password()
+	}
+
+	transport := &http.Transport{Dial: func(network, addr string) (net.Conn, error) {
+		return deadline.Dial(dialer, network, addr, time.Now().Add(timeout))
+	}}
+
+	return &Client{
+		http:      &http.Client{Timeout: timeout, Transport: transport},
+		transport: transport,
+		url:       "http://" + net.JoinHostPort(addr.Host, addr.Port) + "/",
+		user:      user,
+		password:  password,
+	}
+}
+
+func (c *Client) Close() {
+	c.transport.CloseIdleConnections()
+}
+
+// Call sends a JSON-RPC request, and decodes its result into v
+func (c *Client) Call(v interface{}, method string, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(request{"1.0", "bc1isup", method, params})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(c.user, c.password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "%s failed", method)
+	}
+
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return errors.New("RPC authentication failed")
+
+	case http.StatusForbidden:
+		return errors.New("RPC access denied: see -rpcallowip")
+	}
+
+	var r response
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseLength)).Decode(&r)
+	if err != nil {
+		return errors.Wrapf(err, "%s returned invalid response (%s)", method, resp.Status)
+	}
+
+	if r.Error != nil {
+		return Error{method, r.Error.Code, r.Error.Message}
+	}
+
+	return errors.Wrapf(json.Unmarshal(r.Result, v), "unexpected response to %s", method)
+}
+
+func (e Error) Error() string {
+	return fmt.Sprintf("%s failed: %s (%d)", e.Method, e.Message, e.Code)
+}
+
+// Probe asks Bitcoin Core at addr about its chain, network & mempool, with either credentials of addr, or user &
+// password provided (ex. from a cookie)
+func Probe(dialer proxy.Dialer, addr connstring.ConnString, user, password string, timeout time.Duration) (n Node, err error) {
+	log := common.Logger.Get().WithField("address", addr.Raw)
+
+	c := NewClient(dialer, addr, user, password, timeout)
+	defer c.Close()
+
+	if addr.Port == "" {
+		addr.Port = DefaultPort
+	}
+
+	start := time.Now()
+
+	log.Debugln("calling getblockchaininfo…")
+	var chain blockchainInfo
+	err = c.Call(&chain, "getblockchaininfo")
+	if err != nil {
+		return
+	}
+
+	n = Node{
+		Address:              addr.ToString(),
+		Chain:                chain.Chain,
+		LastBlock:            chain.Blocks,
+		Headers:              chain.Headers,
+		InitialBlockDownload: chain.InitialBlockDownload,
+		VerificationProgress: chain.VerificationProgress,
+		Pruned:               chain.Pruned,
+		Warnings:             chain.Warnings,
+		TestNet:              chain.Chain != btc.ChainMain,
+		Latency:              time.Since(start),
+	}
+
+	var network networkInfo
+	err = c.Call(&network, "getnetworkinfo")
+	if err != nil {
+		return
+	}
+
+	n.UserAgent, n.Version, n.Protocol, n.Peers = network.SubVersion, network.Version, network.ProtocolVersion, network.Connections
+	n.Services, _ = strconv.ParseUint(network.LocalServices, 16, 64)
+
+	// same warnings are often returned by both
+	for _, w := range network.Warnings {
+		if !contains(n.Warnings, w) {
+			n.Warnings = append(n.Warnings, w)
+		}
+	}
+
+	var mempool mempoolInfo
+	err = c.Call(&mempool, "getmempoolinfo")
+	if err != nil {
+		return
+	}
+
+	n.MempoolSize, n.MempoolBytes = mempool.Size, mempool.Bytes
+
+	log.WithField("useragent", n.UserAgent).Debugln("node probed")
+	return n, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+
+	return false
+}
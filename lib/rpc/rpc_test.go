@@ -0,0 +1,111 @@
+package rpc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+)
+
+// stand-in answers like a pruned Bitcoin Core v26, still in IBD, would
+func standIn(user, password string) *httptest.Server {
+	results := map[string]interface{}{
+		"getblockchaininfo": map[string]interface{}{
+			"chain": "main", "blocks": 800000, "headers": 868123, "initialblockdownload": true,
+			"verificationprogress": 0.91, "pruned": true, "warnings": "This is a pre-release test build",
+		},
+		"getnetworkinfo": map[string]interface{}{
+			"version": 260000, "subversion": "/Satoshi:26.0.0/", "protocolversion": 70016,
+			"localservices": "0000000000000c08", "connections": 10, "warnings": []string{"This is a pre-release test build"},
+		},
+		"getmempoolinfo": map[string]interface{}{"size": 2500, "bytes": 1200000},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || u != user || p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var req request
+		if json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		result, ok := results[req.Method]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": nil, "error": map[string]interface{}{"code": -32601, "message": "Method not found"}})
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"result": result, "error": nil})
+	}))
+}
+
+func TestProbe(t *testing.T) {
+	server := standIn("__cookie__", "c0ffee")
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	Convey("Given credentials in the address", t, func() {
+		addr, err := connstring.Parse("rpc://__cookie__:c0ffee@" + host)
+		So(err, ShouldBeNil)
+
+		n, err := Probe(proxy.Direct, addr, "", "", time.Second)
+
+		So(err, ShouldBeNil)
+		So(n.Address, ShouldEqual, "rpc://"+host)
+		So(n.UserAgent, ShouldEqual, "/Satoshi:26.0.0/")
+		So(n.Chain, ShouldEqual, "main")
+		So(n.TestNet, ShouldBeFalse)
+		So(n.LastBlock, ShouldEqual, 800000)
+		So(n.Headers, ShouldEqual, 868123)
+		So(n.InitialBlockDownload, ShouldBeTrue)
+		So(n.Pruned, ShouldBeTrue)
+		So(n.Peers, ShouldEqual, 10)
+		So(n.Services, ShouldEqual, 0xc08)
+		So(n.MempoolSize, ShouldEqual, 2500)
+		So(n.Warnings, ShouldResemble, []string{"This is a pre-release test build"})
+	})
+
+	Convey("Given credentials from a cookie", t, func() {
+		dir, err := ioutil.TempDir("", "rpc")
+		So(err, ShouldBeNil)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, ".cookie")
+		So(ioutil.WriteFile(path, []byte("__cookie__:c0ffee"), 0600), ShouldBeNil)
+
+		user, password, err := ReadCookie(path)
+		So(err, ShouldBeNil)
+
+		addr, err := connstring.Parse("rpc://" + host)
+		So(err, ShouldBeNil)
+
+		_, err = Probe(proxy.Direct, addr, user, password, time.Second)
+		So(err, ShouldBeNil)
+	})
+
+	Convey("Given wrong credentials", t, func() {
+		addr, err := connstring.Parse("rpc://__cookie__:stale@" + host)
+		So(err, ShouldBeNil)
+
+		_, err = Probe(proxy.Direct, addr, "", "", time.Second)
+
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "authentication failed")
+	})
+}
@@ -0,0 +1,183 @@
+package stratum
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/pkg/errors"
+)
+
+// ElligatorSwift encodes secp256k1 public keys as 64 bytes indistinguishable from random, see BIP-324.  Only
+// x-coordinates are encoded.  As it's only done once per connection, math/big is fast enough.
+
+const ellSwiftLen = 64
+
+var (
+	fieldP = hexInt("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+
+	// sqrt(-3), the same root as BIP-324 reference uses
+	minus3Sqrt = new(big.Int).Exp(new(big.Int).Sub(fieldP, big.NewInt(3)), sqrtExp, fieldP)
+
+	// p ≡ 3 (mod 4), so square root of a is a^((p+1)/4), if there's one
+	sqrtExp = new(big.Int).Rsh(new(big.Int).Add(fieldP, big.NewInt(1)), 2)
+)
+
+func hexInt(s string) *big.Int {
+	i, _ := new(big.Int).SetString(s, 16)
+	return i
+}
+
+// fe is an element of secp256k1's field
+type fe struct{ *big.Int }
+
+func feInt(i int64) fe { return fe{big.NewInt(i)} }
+
+func feBytes(b []byte) fe {
+	return fe{new(big.Int).Mod(new(big.Int).SetBytes(b), fieldP)}
+}
+
+func (a fe) add(b fe) fe { return fe{new(big.Int).Mod(new(big.Int).Add(a.Int, b.Int), fieldP)} }
+func (a fe) sub(b fe) fe { return fe{new(big.Int).Mod(new(big.Int).Sub(a.Int, b.Int), fieldP)} }
+func (a fe) mul(b fe) fe { return fe{new(big.Int).Mod(new(big.Int).Mul(a.Int, b.Int), fieldP)} }
+func (a fe) neg() fe     { return feInt(0).sub(a) }
+func (a fe) div(b fe) fe { return a.mul(fe{new(big.Int).ModInverse(b.Int, fieldP)}) }
+func (a fe) isZero() bool {
+	return a.Sign() == 0
+}
+
+func (a fe) equals(b fe) bool {
+	return a.Cmp(b.Int) == 0
+}
+
+// sqrt returns a square root of a, and false if there's none
+func (a fe) sqrt() (fe, bool) {
+	r := fe{new(big.Int).Exp(a.Int, sqrtExp, fieldP)}
+	return r, r.mul(r).equals(a)
+}
+
+// bytes returns a as 32 bytes, big-endian
+func (a fe) bytes() []byte {
+	b := make([]byte, 32)
+	a.FillBytes(b)
+	return b
+}
+
+// isValidX is true if x is an x-coordinate of a point on the curve (y² = x³ + 7)
+func isValidX(x fe) bool {
+	_, ok := x.mul(x).mul(x).add(feInt(7)).sqrt()
+	return ok
+}
+
+// xSwiftEC maps any u & t onto an x-coordinate of a point on the curve
+func xSwiftEC(u, t fe) fe {
+	if u.isZero() {
+		u = feInt(1)
+	}
+
+	if t.isZero() {
+		t = feInt(1)
+	}
+
+	u3Plus7 := u.mul(u).mul(u).add(feInt(7))
+	if u3Plus7.add(t.mul(t)).isZero() {
+		t = t.add(t)
+	}
+
+	x := u3Plus7.sub(t.mul(t)).div(t.add(t))
+	y := x.add(t).div(fe{minus3Sqrt}.mul(u))
+
+	for _, candidate := range []fe{
+		u.add(feInt(4).mul(y).mul(y)),
+		x.neg().div(y).sub(u).div(feInt(2)),
+		x.div(y).sub(u).div(feInt(2)),
+	} {
+		if isValidX(candidate) {
+			return candidate
+		}
+	}
+
+	// NOTE: the last candidate is always on the curve, if neither of the other ones is
+	panic("unreachable")
+}
+
+// xSwiftECInv returns t, such that xSwiftEC(u, t) = x, using one of 8 ways (cases) to find it, or false if that way
+// can't be used for this x & u
+func xSwiftECInv(x, u fe, c int) (fe, bool) {
+	u3Plus7 := u.mul(u).mul(u).add(feInt(7))
+
+	var s, v fe
+	if c&2 == 0 {
+		if isValidX(x.neg().sub(u)) {
+			return fe{}, false
+		}
+
+		v = x
+		s = u3Plus7.neg().div(u.mul(u).add(u.mul(v)).add(v.mul(v)))
+	} else {
+		s = x.sub(u)
+		if s.isZero() {
+			return fe{}, false
+		}
+
+		r, ok := s.neg().mul(feInt(4).mul(u3Plus7).add(feInt(3).mul(s).mul(u).mul(u))).sqrt()
+		if !ok || c&1 == 1 && r.isZero() {
+			return fe{}, false
+		}
+
+		if c&1 == 1 {
+			r = r.neg()
+		}
+
+		v = r.div(s).sub(u).div(feInt(2))
+	}
+
+	w, ok := s.sqrt()
+	if !ok {
+		return fe{}, false
+	}
+
+	// t = ±w·(u·(1 ± sqrt(-3))/2 + v)
+	m := fe{minus3Sqrt}
+	if c&1 == 0 {
+		m = m.neg()
+	}
+
+	if (c&1 == 0) == (c&4 == 0) {
+		w = w.neg()
+	}
+
+	return w.mul(u.mul(feInt(1).add(m)).div(feInt(2)).add(v)), true
+}
+
+// ellSwiftDecode returns x-coordinate encoded in b
+func ellSwiftDecode(b []byte) ([]byte, error) {
+	if len(b) != ellSwiftLen {
+		return nil, errors.Errorf("invalid ElligatorSwift encoding length: %d instead of %d", len(b), ellSwiftLen)
+	}
+
+	return xSwiftEC(feBytes(b[:32]), feBytes(b[32:])).bytes(), nil
+}
+
+// ellSwiftEncode returns a random encoding of x-coordinate x
+func ellSwiftEncode(x []byte) ([]byte, error) {
+	xFe := feBytes(x)
+	if !isValidX(xFe) {
+		return nil, errors.New("not an x-coordinate of a point on the curve")
+	}
+
+	var random [33]byte
+	for {
+		_, err := rand.Read(random[:])
+		if err != nil {
+			return nil, err
+		}
+
+		u := feBytes(random[:32])
+		t, ok := xSwiftECInv(xFe, u, int(random[32]&7))
+
+		// NOTE: every t found is checked, as an encoding that doesn't decode back would make a handshake fail
+		if ok && xSwiftEC(u, t).equals(xFe) {
+			return append(u.bytes(), t.bytes()...), nil
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package stratum
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Stratum V2 connections are encrypted with Noise NX handshake, where pool's static key is signed by its authority,
+// see: https://github.com/stratum-mining/sv2-spec/blob/main/04-Protocol-Security.md
+const (
+	noiseProtocolName = "Noise_NX_Secp256k1+EllSwift_ChaChaPoly_SHA256"
+
+	macLen = 16
+
+	// version (2), valid_from (4), not_valid_after (4), and authority's Schnorr signature (64)
+	certificateLen = 2 + 4 + 4 + 64
+
+	// pool's ephemeral key, and encrypted static key & certificate
+	handshakeReplyLen = ellSwiftLen + ellSwiftLen + macLen + certificateLen + macLen
+
+	// each frame is extension type (2), message type (1), and payload length (3)
+	frameHeaderLen = 6
+
+	// frames are encrypted in chunks of at most that many bytes, incl. MAC
+	maxChunkLen = 65535
+)
+
+type (
+	cipherState struct {
+		aead cipher.AEAD
+		n    uint64
+	}
+
+	// symmetricState is chaining key, and hash of the handshake so far, and key to encrypt it with, once there's one
+	symmetricState struct {
+		ck, h []byte
+		k     *cipherState
+	}
+
+	// certificate is what pool's authority signed, along with pool's static key
+	certificate struct {
+		Version       uint16
+		ValidFrom     time.Time
+		NotValidAfter time.Time
+	}
+
+	// noiseConn sends & receives Stratum V2 frames over an encrypted connection
+	noiseConn struct {
+		conn       net.Conn
+		send, recv *cipherState
+	}
+)
+
+func newCipherState(key []byte) *cipherState {
+	// NOTE: only fails for keys of wrong length
+	aead, _ := chacha20poly1305.New(key)
+	return &cipherState{aead: aead}
+}
+
+// nonce is 4 zero bytes, and counter, little-endian
+func (c *cipherState) nonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], c.n)
+	c.n++
+	return nonce
+}
+
+func (c *cipherState) seal(plaintext, ad []byte) []byte {
+	return c.aead.Seal(nil, c.nonce(), plaintext, ad)
+}
+
+func (c *cipherState) open(ciphertext, ad []byte) ([]byte, error) {
+	return c.aead.Open(nil, c.nonce(), ciphertext, ad)
+}
+
+func hashOf(parts ...[]byte) []byte {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+
+	return h.Sum(nil)
+}
+
+func hmacOf(key []byte, parts ...[]byte) []byte {
+	h := hmac.New(sha256.New, key)
+	for _, p := range parts {
+		h.Write(p)
+	}
+
+	return h.Sum(nil)
+}
+
+// hkdf returns two keys derived from chaining key & input key material
+func hkdf(ck, ikm []byte) ([]byte, []byte) {
+	temp := hmacOf(ck, ikm)
+	out1 := hmacOf(temp, []byte{1})
+	return out1, hmacOf(temp, out1, []byte{2})
+}
+
+// newSymmetricState initialises handshake with protocol name, and an empty prologue
+func newSymmetricState() *symmetricState {
+	ck := hashOf([]byte(noiseProtocolName))
+	return &symmetricState{ck: ck, h: hashOf(ck)}
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	s.h = hashOf(s.h, data)
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	var k []byte
+	s.ck, k = hkdf(s.ck, ikm)
+	s.k = newCipherState(k)
+}
+
+func (s *symmetricState) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	plaintext, err := s.k.open(ciphertext, s.h)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixHash(ciphertext)
+	return plaintext, nil
+}
+
+// split returns keys for sending, and receiving by the initiator
+func (s *symmetricState) split() (*cipherState, *cipherState) {
+	k1, k2 := hkdf(s.ck, nil)
+	return newCipherState(k1), newCipherState(k2)
+}
+
+// newNoiseKey returns a key with even Y, as only X of keys is exchanged
+func newNoiseKey() (*btcec.PrivateKey, error) {
+	for {
+		key, err := btcec.NewPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+
+		if key.PubKey().SerializeCompressed()[0] == 0x02 {
+			return key, nil
+		}
+	}
+}
+
+// ecdh returns SHA256 of compressed shared point of key, and a public key encoded with ElligatorSwift
+func ecdh(key *btcec.PrivateKey, encoded []byte) ([]byte, error) {
+	x, err := ellSwiftDecode(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := btcec.ParsePubKey(append([]byte{0x02}, x...))
+	if err != nil {
+		return nil, err
+	}
+
+	var point, shared btcec.JacobianPoint
+	pub.AsJacobian(&point)
+	btcec.ScalarMultNonConst(&key.Key, &point, &shared)
+	shared.ToAffine()
+
+	return hashOf(btcec.NewPublicKey(&shared.X, &shared.Y).SerializeCompressed()), nil
+}
+
+func parseCertificate(b []byte) certificate {
+	return certificate{
+		Version:       binary.LittleEndian.Uint16(b),
+		ValidFrom:     time.Unix(int64(binary.LittleEndian.Uint32(b[2:])), 0),
+		NotValidAfter: time.Unix(int64(binary.LittleEndian.Uint32(b[6:])), 0),
+	}
+}
+
+// noiseHandshake performs NX handshake as the initiator, and returns pool's certificate.  Authority's signature isn't
+// verified, as its key is not known, so just like TLS of Electrum servers, connections are encrypted, but not
+// authenticated.
+func noiseHandshake(conn net.Conn) (*noiseConn, certificate, error) {
+	s := newSymmetricState()
+
+	e, err := newNoiseKey()
+	if err != nil {
+		return nil, certificate{}, err
+	}
+
+	// -> e
+	ephemeral, err := ellSwiftEncode(e.PubKey().SerializeCompressed()[1:])
+	if err != nil {
+		return nil, certificate{}, err
+	}
+
+	s.mixHash(ephemeral)
+
+	// NOTE: there's no key yet, so encrypting an empty payload only mixes it into hash
+	s.mixHash(nil)
+
+	_, err = conn.Write(ephemeral)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "can't send handshake")
+	}
+
+	// <- e, ee, s, es
+	reply := make([]byte, handshakeReplyLen)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "pool didn't complete handshake")
+	}
+
+	re, encryptedStatic, encryptedCertificate := reply[:ellSwiftLen], reply[ellSwiftLen:2*ellSwiftLen+macLen], reply[2*ellSwiftLen+macLen:]
+
+	s.mixHash(re)
+
+	ee, err := ecdh(e, re)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "invalid ephemeral key of pool")
+	}
+
+	s.mixKey(ee)
+
+	rs, err := s.decryptAndHash(encryptedStatic)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "can't decrypt static key of pool")
+	}
+
+	es, err := ecdh(e, rs)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "invalid static key of pool")
+	}
+
+	s.mixKey(es)
+
+	cert, err := s.decryptAndHash(encryptedCertificate)
+	if err != nil {
+		return nil, certificate{}, errors.Wrap(err, "can't decrypt certificate of pool")
+	}
+
+	send, recv := s.split()
+	return &noiseConn{conn, send, recv}, parseCertificate(cert), nil
+}
+
+// encryptedLen is length of payload of length n, once encrypted in chunks
+func encryptedLen(n int) int {
+	chunks := (n + maxChunkLen - macLen - 1) / (maxChunkLen - macLen)
+	return n + chunks*macLen
+}
+
+// writeFrame sends a message with its header, each encrypted separately
+func (c *noiseConn) writeFrame(extension uint16, msgType byte, payload []byte) error {
+	header := make([]byte, frameHeaderLen)
+	binary.LittleEndian.PutUint16(header, extension)
+	header[2] = msgType
+	putUint24(header[3:], uint32(len(payload)))
+
+	frame := c.send.seal(header, nil)
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > maxChunkLen-macLen {
+			n = maxChunkLen - macLen
+		}
+
+		frame = append(frame, c.send.seal(payload[:n], nil)...)
+		payload = payload[n:]
+	}
+
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// readFrame receives a single message
+func (c *noiseConn) readFrame() (extension uint16, msgType byte, payload []byte, err error) {
+	encryptedHeader := make([]byte, frameHeaderLen+macLen)
+	_, err = io.ReadFull(c.conn, encryptedHeader)
+	if err != nil {
+		return
+	}
+
+	header, err := c.recv.open(encryptedHeader, nil)
+	if err != nil {
+		return 0, 0, nil, errors.Wrap(err, "can't decrypt frame header")
+	}
+
+	length := int(uint24(header[3:]))
+	if length > maxMessageLength {
+		return 0, 0, nil, errors.Errorf("message too long: %d bytes", length)
+	}
+
+	encrypted := make([]byte, encryptedLen(length))
+	_, err = io.ReadFull(c.conn, encrypted)
+	if err != nil {
+		return
+	}
+
+	for len(encrypted) > 0 {
+		n := len(encrypted)
+		if n > maxChunkLen {
+			n = maxChunkLen
+		}
+
+		chunk, err := c.recv.open(encrypted[:n], nil)
+		if err != nil {
+			return 0, 0, nil, errors.Wrap(err, "can't decrypt frame")
+		}
+
+		payload = append(payload, chunk...)
+		encrypted = encrypted[n:]
+	}
+
+	return binary.LittleEndian.Uint16(header), header[2], payload, nil
+}
+
+func putUint24(b []byte, v uint32) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
@@ -0,0 +1,257 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	DefaultPort = "3333"
+
+	// DefaultUser & DefaultPassword are used to authorize, unless address has its own credentials.  Most pools reject
+	// them, but still send jobs.
+	DefaultUser     = "bc1isup"
+	DefaultPassword = "x"
+
+	ClientName = "bc1isup/0.0.1"
+
+	// version bits miners are allowed to roll, as requested, see BIP-310
+	versionRollingMask = "1fffe000"
+
+	// responses are single lines, but ex. mining.notify can carry a long merkle branch
+	maxMessageLength = 1 << 20
+)
+
+const (
+	idConfigure = iota + 1
+	idSubscribe
+	idAuthorize
+)
+
+type (
+	// Pool is what's known about a Stratum V1, or V2 endpoint after a single probe
+	Pool struct {
+		Address            string  `json:"address"`
+		Job                string  `json:"job"`
+		PrevHash           string  `json:"prevhash"`
+		LastBlock          int     `json:"lastblock,omitempty"`
+		Version            string  `json:"version"`
+		VersionRolling     bool    `json:"version_rolling"`
+		VersionRollingMask string  `json:"version_rolling_mask,omitempty"`
+		Difficulty         float64 `json:"difficulty"`
+		Authorized         bool    `json:"authorized"`
+
+		// Tip, and how many blocks Behind it the pool is, are set by callers comparing PrevHash against a node
+		Tip    string `json:"tip,omitempty"`
+		Behind int    `json:"behind,omitempty"`
+
+		// Latency is how long it took to connect, and subscribe
+		Latency time.Duration `json:"-"`
+	}
+
+	request struct {
+		Id     int           `json:"id"`
+		Method string        `json:"method"`
+		Params []interface{} `json:"params"`
+	}
+
+	// message is either a response to a request, or a notification (w/o id) from the pool
+	message struct {
+		Id     *int              `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+		Result json.RawMessage   `json:"result"`
+		Error  json.RawMessage   `json:"error"`
+	}
+)
+
+func (m message) failed() bool {
+	return len(m.Error) > 0 && string(m.Error) != "null"
+}
+
+// PrevHash converts previous block hash from mining.notify, where each 4-byte word is byte-swapped, into the byte
+// order used by RPCs & block explorers
+func PrevHash(notified string) (string, error) {
+	b, err := hex.DecodeString(notified)
+	if err != nil || len(b) != 32 {
+		return "", errors.Errorf("invalid prevhash: %s", notified)
+	}
+
+	out := make([]byte, 0, 32)
+	for i := len(b) - 4; i >= 0; i -= 4 {
+		out = append(out, b[i:i+4]...)
+	}
+
+	return hex.EncodeToString(out), nil
+}
+
+// CoinbaseHeight returns height of the block being mined, as committed to at the start of coinbase's script (BIP-34),
+// given first part of the coinbase from mining.notify
+func CoinbaseHeight(coinb1 string) (int, error) {
+	b, err := hex.DecodeString(coinb1)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid coinbase")
+	}
+
+	// version (4), input count (1), previous output (36), script length (1), and first push of the script
+	const pushAt = 4 + 1 + 36 + 1
+	if len(b) <= pushAt || b[4] != 1 || b[pushAt-1] >= 0xfd {
+		return 0, errors.New("unexpected coinbase format")
+	}
+
+	op := b[pushAt]
+	switch {
+	// heights up to 16 are pushed with OP_1…OP_16
+	case op >= 0x51 && op <= 0x60:
+		return int(op - 0x50), nil
+
+	case op < 1 || op > 8 || len(b) < pushAt+1+int(op):
+		return 0, errors.New("coinbase doesn't start with height")
+	}
+
+	var le [8]byte
+	copy(le[:], b[pushAt+1:pushAt+1+int(op)])
+
+	return int(binary.LittleEndian.Uint64(le[:])), nil
+}
+
+// Probe connects to a Stratum V1 pool at addr, subscribes, authorizes with credentials of addr (or DefaultUser), and
+// waits for the first job
+func Probe(dialer proxy.Dialer, addr connstring.ConnString, timeout time.Duration) (p Pool, err error) {
+	log := common.Logger.Get().WithField("address", addr.Raw)
+
+	if addr.Port == "" {
+		addr.Port = DefaultPort
+	}
+
+	user, password := DefaultUser, DefaultPassword
+	if addr.User != nil {
+		user = addr.User.Username()
+		if pass, ok := addr.User.Password(); ok {
+			password = pass
+		}
+	}
+
+	start := time.Now()
+
+	log.Debugln("connecting…")
+	conn, err := deadline.Dial(dialer, "tcp", net.JoinHostPort(addr.Host, addr.Port), start.Add(timeout))
+	if err != nil {
+		return p, errors.Wrap(err, "can't connect to pool")
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(start.Add(timeout))
+
+	// pools process requests in order, so all can be sent at once
+	enc := json.NewEncoder(conn)
+	for _, req := range []request{
+		{idConfigure, "mining.configure", []interface{}{
+			[]string{"version-rolling"},
+			map[string]interface{}{"version-rolling.mask": versionRollingMask, "version-rolling.min-bit-count": 2},
+		}},
+		{idSubscribe, "mining.subscribe", []interface{}{ClientName}},
+		{idAuthorize, "mining.authorize", []interface{}{user, password}},
+	} {
+		err = enc.Encode(req)
+		if err != nil {
+			return p, errors.Wrapf(err, "can't send %s", req.Method)
+		}
+	}
+
+	p = Pool{Address: addr.ToString()}
+
+	r := bufio.NewReaderSize(conn, maxMessageLength)
+	subscribed, authorizeAnswered, notified := false, false, false
+
+	// NOTE: pools that don't know mining.configure might not respond to it at all, so it's not waited for
+	for !subscribed || !authorizeAnswered || !notified {
+		line, err := r.ReadSlice('\n')
+		if err != nil {
+			if !subscribed {
+				return p, errors.Wrap(err, "pool didn't respond to mining.subscribe")
+			}
+
+			if !notified {
+				return p, errors.Wrap(err, "no job received")
+			}
+
+			// some pools just disconnect unknown workers
+			break
+		}
+
+		var m message
+		err = json.Unmarshal(line, &m)
+		if err != nil {
+			return p, errors.Wrap(err, "pool sent invalid JSON")
+		}
+
+		switch {
+		case m.Id != nil && *m.Id == idConfigure:
+			var result map[string]interface{}
+			if !m.failed() && json.Unmarshal(m.Result, &result) == nil {
+				p.VersionRolling, _ = result["version-rolling"].(bool)
+				p.VersionRollingMask, _ = result["version-rolling.mask"].(string)
+			}
+
+		case m.Id != nil && *m.Id == idSubscribe:
+			if m.failed() {
+				return p, errors.Errorf("mining.subscribe failed: %s", m.Error)
+			}
+
+			subscribed = true
+			p.Latency = time.Since(start)
+
+		case m.Id != nil && *m.Id == idAuthorize:
+			authorizeAnswered = true
+			_ = json.Unmarshal(m.Result, &p.Authorized)
+
+		case m.Method == "mining.set_difficulty" && len(m.Params) > 0:
+			_ = json.Unmarshal(m.Params[0], &p.Difficulty)
+
+		case m.Method == "mining.set_version_mask" && len(m.Params) > 0:
+			_ = json.Unmarshal(m.Params[0], &p.VersionRollingMask)
+
+		case m.Method == "mining.notify":
+			// job_id, prevhash, coinb1, coinb2, merkle_branch, version, nbits, ntime, clean_jobs
+			var job, prevHash, coinb1, version string
+			if len(m.Params) < 9 ||
+				json.Unmarshal(m.Params[0], &job) != nil ||
+				json.Unmarshal(m.Params[1], &prevHash) != nil ||
+				json.Unmarshal(m.Params[2], &coinb1) != nil ||
+				json.Unmarshal(m.Params[5], &version) != nil {
+				return p, errors.New("pool sent invalid mining.notify")
+			}
+
+			p.Job, p.Version = job, version
+
+			p.PrevHash, err = PrevHash(prevHash)
+			if err != nil {
+				return p, err
+			}
+
+			height, err := CoinbaseHeight(coinb1)
+			if err != nil {
+				log.WithError(err).Debugln("unable to read height from coinbase")
+			} else {
+				p.LastBlock = height - 1
+			}
+
+			notified = true
+		}
+	}
+
+	log.WithField("prevhash", p.PrevHash).Debugln("job received")
+	return p, nil
+}
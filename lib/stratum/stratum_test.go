@@ -0,0 +1,106 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+)
+
+const (
+	// block 125552, as notified, and as shown by block explorers
+	notifiedPrevHash = "4d16b6f85af6e2198f44ae2a6de67f78487ae5611b77c6c0440b921e00000000"
+	prevHash         = "00000000440b921e1b77c6c0487ae5616de67f788f44ae2a5af6e2194d16b6f8"
+
+	// coinbase of block 868124 up to extranonce: version, one input spending nothing, and script pushing height first
+	coinb1 = "01000000" + "01" + "0000000000000000000000000000000000000000000000000000000000000000ffffffff" + "2a" + "031c3f0d"
+)
+
+// pool answers like a pool that doesn't know mining.configure, and rejects unknown workers, would
+func pool(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		enc, dec := json.NewEncoder(conn), json.NewDecoder(bufio.NewReader(conn))
+		for {
+			var req request
+			if dec.Decode(&req) != nil {
+				return
+			}
+
+			switch req.Method {
+			case "mining.subscribe":
+				_ = enc.Encode(map[string]interface{}{"id": req.Id, "result": []interface{}{[]interface{}{}, "08000002", 4}, "error": nil})
+				_ = enc.Encode(map[string]interface{}{"id": nil, "method": "mining.set_difficulty", "params": []interface{}{65536}})
+				_ = enc.Encode(map[string]interface{}{"id": nil, "method": "mining.notify", "params": []interface{}{
+					"bf", notifiedPrevHash, coinb1, "ffffffff", []string{}, "20000000", "17034219", "670f7a0c", true,
+				}})
+
+			case "mining.authorize":
+				_ = enc.Encode(map[string]interface{}{"id": req.Id, "result": false, "error": []interface{}{24, "Unauthorized worker", nil}})
+			}
+		}
+	}()
+
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func TestPrevHash(t *testing.T) {
+	Convey("Given a prevhash from mining.notify", t, func() {
+		h, err := PrevHash(notifiedPrevHash)
+
+		So(err, ShouldBeNil)
+		So(h, ShouldEqual, prevHash)
+
+		_, err = PrevHash("00")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestCoinbaseHeight(t *testing.T) {
+	Convey("Given a coinbase committing to height", t, func() {
+		height, err := CoinbaseHeight(coinb1)
+
+		So(err, ShouldBeNil)
+		So(height, ShouldEqual, 868124)
+	})
+
+	Convey("Given a truncated coinbase", t, func() {
+		_, err := CoinbaseHeight(coinb1[:40])
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestProbe(t *testing.T) {
+	Convey("Given a pool", t, func() {
+		addr, err := connstring.Parse("stratum+tcp://" + pool(t))
+		So(err, ShouldBeNil)
+
+		p, err := Probe(proxy.Direct, addr, time.Second)
+
+		So(err, ShouldBeNil)
+		So(p.Job, ShouldEqual, "bf")
+		So(p.PrevHash, ShouldEqual, prevHash)
+		So(p.LastBlock, ShouldEqual, 868123)
+		So(p.Version, ShouldEqual, "20000000")
+		So(p.Difficulty, ShouldEqual, 65536)
+		So(p.VersionRolling, ShouldBeFalse)
+		So(p.Authorized, ShouldBeFalse)
+	})
+}
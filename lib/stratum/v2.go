@@ -0,0 +1,295 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/common"
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"github.com/pkg/errors"
+	"golang.org/x/net/proxy"
+)
+
+// DefaultPortV2 is the port SRI (Stratum V2 reference implementation) pools listen on by default
+const DefaultPortV2 = "34254"
+
+// messages of Stratum V2 Common & Mining protocols, see: https://github.com/stratum-mining/sv2-spec
+const (
+	msgSetupConnection             = 0x00
+	msgSetupConnectionSuccess      = 0x01
+	msgSetupConnectionError        = 0x02
+	msgOpenStandardMiningChannel   = 0x10
+	msgOpenStandardMiningChannelOk = 0x11
+	msgOpenMiningChannelError      = 0x12
+	msgNewMiningJob                = 0x15
+	msgSetNewPrevHash              = 0x20
+	msgSetTarget                   = 0x21
+)
+
+const (
+	protocolMining  = 0
+	protocolVersion = 2
+
+	// sent in SetupConnection: only standard channels are used
+	flagRequiresStandardJobs = 1 << 0
+
+	// received in SetupConnection.Success: version can't be rolled
+	flagRequiresFixedVersion = 1 << 0
+
+	openChannelRequestId = 1
+
+	// 1 TH/s, pools might set difficulty based on it
+	nominalHashRate float32 = 1e12
+
+	// version bits miners can roll in V2, see BIP-320
+	versionRollingMaskV2 = "1fffe000"
+)
+
+// diff1Target is the target of share difficulty 1
+var diff1Target = new(big.Int).Lsh(big.NewInt(0xffff), 208)
+
+// v2Writer encodes fields of Stratum V2 messages, all little-endian
+type v2Writer struct{ bytes.Buffer }
+
+func (w *v2Writer) u8(v uint8) { w.WriteByte(v) }
+
+func (w *v2Writer) u16(v uint16) { _ = binary.Write(w, binary.LittleEndian, v) }
+
+func (w *v2Writer) u32(v uint32) { _ = binary.Write(w, binary.LittleEndian, v) }
+
+func (w *v2Writer) f32(v float32) { w.u32(math.Float32bits(v)) }
+
+// str writes STR0_255, which is prefixed with its length
+func (w *v2Writer) str(s string) {
+	if len(s) > 255 {
+		s = s[:255]
+	}
+
+	w.u8(uint8(len(s)))
+	w.WriteString(s)
+}
+
+// v2Reader decodes fields of Stratum V2 messages, and remembers if any of them was cut short
+type v2Reader struct {
+	b   []byte
+	err error
+}
+
+func (r *v2Reader) next(n int) []byte {
+	if r.err != nil || len(r.b) < n {
+		r.err = errors.New("message too short")
+		return make([]byte, n)
+	}
+
+	out := r.b[:n]
+	r.b = r.b[n:]
+	return out
+}
+
+func (r *v2Reader) u8() uint8 { return r.next(1)[0] }
+
+func (r *v2Reader) u16() uint16 { return binary.LittleEndian.Uint16(r.next(2)) }
+
+func (r *v2Reader) u32() uint32 { return binary.LittleEndian.Uint32(r.next(4)) }
+
+// u256 is read as is, little-endian
+func (r *v2Reader) u256() []byte { return r.next(32) }
+
+func (r *v2Reader) str() string { return string(r.next(int(r.u8()))) }
+
+// difficulty converts a little-endian U256 target into share difficulty
+func difficulty(target []byte) float64 {
+	be := make([]byte, len(target))
+	for i, b := range target {
+		be[len(target)-1-i] = b
+	}
+
+	t := new(big.Int).SetBytes(be)
+	if t.Sign() == 0 {
+		return 0
+	}
+
+	d, _ := new(big.Float).Quo(new(big.Float).SetInt(diff1Target), new(big.Float).SetInt(t)).Float64()
+	return d
+}
+
+// reversedHex returns hash in the byte order used by RPCs & block explorers
+func reversedHex(hash []byte) string {
+	out := make([]byte, len(hash))
+	for i, b := range hash {
+		out[len(hash)-1-i] = b
+	}
+
+	return hex.EncodeToString(out)
+}
+
+func setupConnection(host, port string) []byte {
+	p, _ := strconv.ParseUint(port, 10, 16)
+
+	var w v2Writer
+	w.u8(protocolMining)
+	w.u16(protocolVersion)
+	w.u16(protocolVersion)
+	w.u32(flagRequiresStandardJobs)
+	w.str(host)
+	w.u16(uint16(p))
+	w.str("bc1toolkit")
+	w.str("")
+	w.str(ClientName)
+	w.str("")
+	return w.Bytes()
+}
+
+func openStandardMiningChannel(user string) []byte {
+	var w v2Writer
+	w.u32(openChannelRequestId)
+	w.str(user)
+	w.f32(nominalHashRate)
+	w.Write(bytes.Repeat([]byte{0xff}, 32))
+	return w.Bytes()
+}
+
+// ProbeV2 connects to a Stratum V2 pool at addr, opens a standard mining channel for worker of addr (or DefaultUser),
+// and waits for the first job, and block it builds on.  Height of that block is not known, as V2 jobs carry only
+// merkle root.
+func ProbeV2(dialer proxy.Dialer, addr connstring.ConnString, timeout time.Duration) (p Pool, err error) {
+	log := common.Logger.Get().WithField("address", addr.Raw)
+
+	if addr.Port == "" {
+		addr.Port = DefaultPortV2
+	}
+
+	user := DefaultUser
+	if addr.User != nil {
+		user = addr.User.Username()
+	}
+
+	start := time.Now()
+
+	log.Debugln("connecting…")
+	conn, err := deadline.Dial(dialer, "tcp", net.JoinHostPort(addr.Host, addr.Port), start.Add(timeout))
+	if err != nil {
+		return p, errors.Wrap(err, "can't connect to pool")
+	}
+
+	defer conn.Close()
+
+	conn.SetDeadline(start.Add(timeout))
+
+	c, cert, err := noiseHandshake(conn)
+	if err != nil {
+		return p, err
+	}
+
+	log.WithField("valid_until", cert.NotValidAfter).Debugln("handshake ok")
+
+	if time.Now().After(cert.NotValidAfter) {
+		return p, errors.Errorf("pool's certificate expired at %s", cert.NotValidAfter.UTC().Format(time.RFC3339))
+	}
+
+	// pools process messages in order, so both can be sent at once
+	err = c.writeFrame(0, msgSetupConnection, setupConnection(addr.Host, addr.Port))
+	if err != nil {
+		return p, errors.Wrap(err, "can't send SetupConnection")
+	}
+
+	err = c.writeFrame(0, msgOpenStandardMiningChannel, openStandardMiningChannel(user))
+	if err != nil {
+		return p, errors.Wrap(err, "can't send OpenStandardMiningChannel")
+	}
+
+	p = Pool{Address: addr.ToString()}
+
+	// versions of jobs by their id, as jobs are sent before the block they build on
+	versions := make(map[uint32]uint32)
+	var prevHashJob *uint32
+
+	for {
+		if prevHashJob != nil {
+			if version, ok := versions[*prevHashJob]; ok {
+				p.Job, p.Version = fmt.Sprint(*prevHashJob), fmt.Sprintf("%08x", version)
+				break
+			}
+		}
+
+		_, msgType, payload, err := c.readFrame()
+		if err != nil {
+			if !p.Authorized {
+				return p, errors.Wrap(err, "pool didn't open mining channel")
+			}
+
+			return p, errors.Wrap(err, "no job received")
+		}
+
+		r := &v2Reader{b: payload}
+
+		switch msgType {
+		case msgSetupConnectionSuccess:
+			r.u16()
+			flags := r.u32()
+
+			p.VersionRolling = flags&flagRequiresFixedVersion == 0
+			if p.VersionRolling {
+				p.VersionRollingMask = versionRollingMaskV2
+			}
+
+		case msgSetupConnectionError:
+			r.u32()
+			return p, errors.Errorf("SetupConnection failed: %s", r.str())
+
+		case msgOpenStandardMiningChannelOk:
+			r.u32()
+			r.u32()
+			p.Difficulty = difficulty(r.u256())
+			p.Authorized = true
+			p.Latency = time.Since(start)
+
+		case msgOpenMiningChannelError:
+			r.u32()
+			return p, errors.Errorf("OpenStandardMiningChannel failed: %s", r.str())
+
+		case msgNewMiningJob:
+			r.u32()
+			job := r.u32()
+
+			// min_ntime is OPTION[U32], and only set for jobs that are not future ones
+			if r.u8() == 1 {
+				r.u32()
+			}
+
+			version := r.u32()
+			if r.err == nil {
+				versions[job] = version
+			}
+
+		case msgSetNewPrevHash:
+			r.u32()
+			job := r.u32()
+			prevHash := r.u256()
+			if r.err == nil {
+				p.PrevHash, prevHashJob = reversedHex(prevHash), &job
+			}
+
+		case msgSetTarget:
+			r.u32()
+			if target := r.u256(); r.err == nil {
+				p.Difficulty = difficulty(target)
+			}
+		}
+
+		if r.err != nil {
+			return p, errors.Wrapf(r.err, "pool sent invalid message %#02x", msgType)
+		}
+	}
+
+	log.WithField("prevhash", p.PrevHash).Debugln("job received")
+	return p, nil
+}
@@ -0,0 +1,263 @@
+package stratum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/connstring"
+	. "github.com/smartystreets/goconvey/convey"
+	"golang.org/x/net/proxy"
+)
+
+func (s *symmetricState) encryptAndHash(plaintext []byte) []byte {
+	ciphertext := s.k.seal(plaintext, s.h)
+	s.mixHash(ciphertext)
+	return ciphertext
+}
+
+// respond performs NX handshake as a pool would, with a certificate valid until notValidAfter
+func respond(conn net.Conn, notValidAfter time.Time) (*noiseConn, error) {
+	s := newSymmetricState()
+
+	ie := make([]byte, ellSwiftLen)
+	_, err := io.ReadFull(conn, ie)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixHash(ie)
+	s.mixHash(nil)
+
+	e, err := newNoiseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ephemeral, err := ellSwiftEncode(e.PubKey().SerializeCompressed()[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixHash(ephemeral)
+
+	ee, err := ecdh(e, ie)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixKey(ee)
+
+	static, err := newNoiseKey()
+	if err != nil {
+		return nil, err
+	}
+
+	staticEncoded, err := ellSwiftEncode(static.PubKey().SerializeCompressed()[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	reply := append(ephemeral, s.encryptAndHash(staticEncoded)...)
+
+	es, err := ecdh(static, ie)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mixKey(es)
+
+	cert := make([]byte, certificateLen)
+	binary.LittleEndian.PutUint32(cert[2:], uint32(notValidAfter.Add(-time.Hour).Unix()))
+	binary.LittleEndian.PutUint32(cert[6:], uint32(notValidAfter.Unix()))
+
+	reply = append(reply, s.encryptAndHash(cert)...)
+
+	_, err = conn.Write(reply)
+	if err != nil {
+		return nil, err
+	}
+
+	k1, k2 := s.split()
+	return &noiseConn{conn, k2, k1}, nil
+}
+
+// poolV2 answers like a Stratum V2 pool, that doesn't allow version rolling, would
+func poolV2(t *testing.T, notValidAfter time.Time, user chan<- string) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prevHashLE, _ := hex.DecodeString(reversedHex(mustHex(prevHash)))
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		c, err := respond(conn, notValidAfter)
+		if err != nil {
+			return
+		}
+
+		for {
+			_, msgType, payload, err := c.readFrame()
+			if err != nil {
+				return
+			}
+
+			var w v2Writer
+			switch msgType {
+			case msgSetupConnection:
+				w.u16(protocolVersion)
+				w.u32(flagRequiresFixedVersion)
+				_ = c.writeFrame(0, msgSetupConnectionSuccess, w.Bytes())
+
+			case msgOpenStandardMiningChannel:
+				r := &v2Reader{b: payload}
+				r.u32()
+				user <- r.str()
+
+				// difficulty 65536
+				target := make([]byte, 32)
+				target[24], target[25] = 0xff, 0xff
+
+				w.u32(openChannelRequestId)
+				w.u32(1)
+				w.Write(target)
+				w.str("")
+				w.u32(0)
+				_ = c.writeFrame(0, msgOpenStandardMiningChannelOk, w.Bytes())
+
+				// a future job, and block it builds on
+				var job v2Writer
+				job.u32(1)
+				job.u32(7)
+				job.u8(0)
+				job.u32(0x20000000)
+				job.Write(make([]byte, 32))
+				_ = c.writeFrame(1<<15, msgNewMiningJob, job.Bytes())
+
+				var prev v2Writer
+				prev.u32(1)
+				prev.u32(7)
+				prev.Write(prevHashLE)
+				prev.u32(0x670f7a0c)
+				prev.u32(0x17034219)
+				_ = c.writeFrame(1<<15, msgSetNewPrevHash, prev.Bytes())
+			}
+		}
+	}()
+
+	t.Cleanup(func() { l.Close() })
+	return l.Addr().String()
+}
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+func TestEllSwift(t *testing.T) {
+	Convey("Given an encoding of zeros, it should decode as in BIP-324 test vectors", t, func() {
+		x, err := ellSwiftDecode(make([]byte, ellSwiftLen))
+
+		So(err, ShouldBeNil)
+		So(hex.EncodeToString(x), ShouldEqual, "edd1fd3e327ce90cc7a3542614289aee9682003e9cf7dcc9cf2ca9743be5aa0c")
+	})
+
+	Convey("Given keys, their encodings should be random, and decode back", t, func() {
+		for i := 0; i < 16; i++ {
+			key, err := newNoiseKey()
+			So(err, ShouldBeNil)
+
+			x := key.PubKey().SerializeCompressed()[1:]
+
+			a, err := ellSwiftEncode(x)
+			So(err, ShouldBeNil)
+
+			b, err := ellSwiftEncode(x)
+			So(err, ShouldBeNil)
+			So(a, ShouldNotResemble, b)
+
+			decoded, err := ellSwiftDecode(a)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, x)
+		}
+	})
+}
+
+func TestFrames(t *testing.T) {
+	Convey("Given a handshake over a pipe", t, func() {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		responded := make(chan *noiseConn, 1)
+		go func() {
+			c, _ := respond(server, time.Now().Add(time.Hour))
+			responded <- c
+		}()
+
+		c, cert, err := noiseHandshake(client)
+		So(err, ShouldBeNil)
+		So(cert.NotValidAfter.After(time.Now()), ShouldBeTrue)
+
+		pool := <-responded
+		So(pool, ShouldNotBeNil)
+
+		Convey("payloads longer than a chunk should be split, and joined back", func() {
+			payload := bytes.Repeat([]byte{0xbc}, 2*maxChunkLen)
+			So(encryptedLen(len(payload)), ShouldEqual, len(payload)+3*macLen)
+
+			go func() { _ = c.writeFrame(1<<15, msgNewMiningJob, payload) }()
+
+			extension, msgType, received, err := pool.readFrame()
+			So(err, ShouldBeNil)
+			So(extension, ShouldEqual, 1<<15)
+			So(msgType, ShouldEqual, msgNewMiningJob)
+			So(received, ShouldResemble, payload)
+		})
+	})
+}
+
+func TestProbeV2(t *testing.T) {
+	Convey("Given a Stratum V2 pool", t, func() {
+		user := make(chan string, 1)
+		addr, err := connstring.Parse("stratum2+tcp://worker.1@" + poolV2(t, time.Now().Add(time.Hour), user))
+		So(err, ShouldBeNil)
+
+		p, err := ProbeV2(proxy.Direct, addr, time.Second)
+
+		So(err, ShouldBeNil)
+		So(<-user, ShouldEqual, "worker.1")
+		So(p.Job, ShouldEqual, "7")
+		So(p.PrevHash, ShouldEqual, prevHash)
+		So(p.LastBlock, ShouldEqual, 0)
+		So(p.Version, ShouldEqual, "20000000")
+		So(p.Difficulty, ShouldEqual, 65536)
+		So(p.VersionRolling, ShouldBeFalse)
+		So(p.Authorized, ShouldBeTrue)
+	})
+
+	Convey("Given a Stratum V2 pool with an expired certificate", t, func() {
+		addr, err := connstring.Parse("stratum2+tcp://" + poolV2(t, time.Now().Add(-time.Minute), make(chan string, 1)))
+		So(err, ShouldBeNil)
+
+		_, err = ProbeV2(proxy.Direct, addr, time.Second)
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "expired")
+	})
+}
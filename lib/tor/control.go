@@ -0,0 +1,383 @@
+package tor
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/keyvalue"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultControlPort = "127.0.0.1:9051"
+
+	dialTimeout = 5 * time.Second
+	eventBuffer = 64
+
+	statusOk    = 250
+	statusEvent = 650
+
+	authNull       = "NULL"
+	authPassword   = "HASHEDPASSWORD"
+	authCookie     = "COOKIE"
+	authSafeCookie = "SAFECOOKIE"
+
+	serverToControllerKey = "Tor safe cookie authentication server-to-controller hash"
+	controllerToServerKey = "Tor safe cookie authentication controller-to-server hash"
+)
+
+type (
+	// Reply is a single, possibly multi-line, response from Tor's control port
+	Reply struct {
+		Status int
+		Lines  []string
+	}
+
+	// Event is an asynchronous reply Tor sends after `SETEVENTS`, ex. `CIRC 1 BUILT …`
+	Event struct {
+		Name string
+		Data string
+	}
+
+	Controller struct {
+		// CookieFile overrides cookie location reported by Tor, useful when Tor runs in a container
+		CookieFile string
+
+		conn    net.Conn
+		reader  *textproto.Reader
+		mu      sync.Mutex
+		replies chan *Reply
+		events  chan Event
+		err     error
+	}
+
+	// ProtocolInfo is what Tor reports before authentication happens
+	ProtocolInfo struct {
+		AuthMethods []string
+		CookieFile  string
+		TorVersion  string
+	}
+
+	// BootstrapPhase is parsed from `GETINFO status/bootstrap-phase`
+	BootstrapPhase struct {
+		Progress int
+		Tag      string
+		Summary  string
+	}
+)
+
+// DialControl connects to Tor's control port.  Authenticate() has to be called before anything else.
+func DialControl(addr string) (*Controller, error) {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't connect to Tor control port")
+	}
+
+	return NewController(conn), nil
+}
+
+// NewController wraps an already established connection to a control port
+func NewController(conn net.Conn) *Controller {
+	c := &Controller{
+		conn:    conn,
+		reader:  textproto.NewReader(bufio.NewReader(conn)),
+		replies: make(chan *Reply),
+		events:  make(chan Event, eventBuffer),
+	}
+
+	go c.readLoop()
+
+	return c
+}
+
+func (c *Controller) Close() error {
+	return c.conn.Close()
+}
+
+// Events returns a channel of events subscribed to with SetEvents().  It's closed once connection is.
+func (c *Controller) Events() <-chan Event {
+	return c.events
+}
+
+func (c *Controller) readReply() (*Reply, error) {
+	r := &Reply{}
+	for {
+		line, err := c.reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(line) < 4 {
+			return nil, errors.Errorf("malformed reply line: %q", line)
+		}
+
+		r.Status, err = strconv.Atoi(line[:3])
+		if err != nil {
+			return nil, errors.Errorf("malformed reply status: %q", line)
+		}
+
+		switch line[3] {
+		case ' ':
+			r.Lines = append(r.Lines, line[4:])
+			return r, nil
+
+		case '-':
+			r.Lines = append(r.Lines, line[4:])
+
+		// data follows, terminated with a single `.`
+		case '+':
+			data, err := c.reader.ReadDotLines()
+			if err != nil {
+				return nil, err
+			}
+
+			r.Lines = append(r.Lines, line[4:]+"\n"+strings.Join(data, "\n"))
+
+		default:
+			return nil, errors.Errorf("malformed reply line: %q", line)
+		}
+	}
+}
+
+func (c *Controller) readLoop() {
+	defer close(c.events)
+	defer close(c.replies)
+
+	for {
+		r, err := c.readReply()
+		if err != nil {
+			c.err = errors.Wrap(err, "Tor control connection lost")
+			return
+		}
+
+		if r.Status != statusEvent {
+			c.replies <- r
+			continue
+		}
+
+		name := r.Lines[0]
+		data := ""
+		if i := strings.IndexAny(name, " \n"); i != -1 {
+			name, data = name[:i], strings.Join(append([]string{name[i+1:]}, r.Lines[1:]...), "\n")
+		}
+
+		select {
+		case c.events <- Event{name, data}:
+		default:
+			// nobody listens fast enough; dropping is better than blocking command replies
+		}
+	}
+}
+
+// Request sends a raw command, and returns its reply.  Non-250 replies are returned along with an error.
+func (c *Controller) Request(format string, args ...interface{}) (*Reply, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := fmt.Fprintf(c.conn, format+"\r\n", args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't send command to Tor")
+	}
+
+	r, ok := <-c.replies
+	if !ok {
+		return nil, c.err
+	}
+
+	if r.Status != statusOk {
+		return r, errors.Errorf("Tor replied: %d %s", r.Status, r.Lines[len(r.Lines)-1])
+	}
+
+	return r, nil
+}
+
+func (c *Controller) ProtocolInfo() (pi ProtocolInfo, err error) {
+	r, err := c.Request("PROTOCOLINFO 1")
+	if err != nil {
+		return
+	}
+
+	for _, line := range r.Lines {
+		switch {
+		case strings.HasPrefix(line, "AUTH "):
+			kv := keyvalue.Parse(line[5:])
+			pi.AuthMethods = strings.Split(kv["METHODS"], ",")
+			pi.CookieFile = kv["COOKIEFILE"]
+
+		case strings.HasPrefix(line, "VERSION "):
+			pi.TorVersion = keyvalue.Parse(line[8:])["Tor"]
+		}
+	}
+
+	return
+}
+
+// Authenticate picks the best method Tor offers.  Password is only used if cookie auth is unavailable.
+func (c *Controller) Authenticate(password string) error {
+	pi, err := c.ProtocolInfo()
+	if err != nil {
+		return errors.Wrap(err, "can't get protocol info")
+	}
+
+	methods := make(map[string]bool)
+	for _, m := range pi.AuthMethods {
+		methods[m] = true
+	}
+
+	cookieFile := pi.CookieFile
+	if c.CookieFile != "" {
+		cookieFile = c.CookieFile
+	}
+
+	switch {
+	case methods[authNull]:
+		_, err = c.Request("AUTHENTICATE")
+
+	case methods[authSafeCookie] && cookieFile != "":
+		err = c.authSafeCookie(cookieFile)
+
+	case methods[authCookie] && cookieFile != "":
+		var cookie []byte
+		cookie, err = ioutil.ReadFile(cookieFile)
+		if err != nil {
+			return errors.Wrap(err, "can't read Tor auth cookie")
+		}
+
+		_, err = c.Request("AUTHENTICATE %x", cookie)
+
+	case methods[authPassword]:
+		if password == "" {
+			return errors.New("Tor requires a control port password")
+		}
+
+		// NOTE: sent hex-encoded, as a quoted password could carry CRLF, and with it other commands
+		_, err = c.Request("AUTHENTICATE %x", password)
+
+	default:
+		return errors.Errorf("no supported auth method among: %s", strings.Join(pi.AuthMethods, ", "))
+	}
+
+	return errors.Wrap(err, "Tor authentication failed")
+}
+
+func (c *Controller) authSafeCookie(cookieFile string) error {
+	cookie, err := ioutil.ReadFile(cookieFile)
+	if err != nil {
+		return errors.Wrap(err, "can't read Tor auth cookie")
+	}
+
+	clientNonce := make([]byte, 32)
+	_, err = rand.Read(clientNonce)
+	if err != nil {
+		return errors.Wrap(err, "can't generate nonce")
+	}
+
+	r, err := c.Request("AUTHCHALLENGE SAFECOOKIE %x", clientNonce)
+	if err != nil {
+		return err
+	}
+
+	kv := keyvalue.Parse(strings.TrimPrefix(r.Lines[0], "AUTHCHALLENGE "))
+
+	serverHash, err := hex.DecodeString(kv["SERVERHASH"])
+	if err != nil {
+		return errors.Wrap(err, "invalid SERVERHASH")
+	}
+
+	serverNonce, err := hex.DecodeString(kv["SERVERNONCE"])
+	if err != nil {
+		return errors.Wrap(err, "invalid SERVERNONCE")
+	}
+
+	msg := append(append(append([]byte{}, cookie...), clientNonce...), serverNonce...)
+
+	// make sure Tor actually knows the cookie, before revealing anything derived from it
+	if !hmac.Equal(serverHash, safeCookieHash(serverToControllerKey, msg)) {
+		return errors.New("Tor sent invalid SERVERHASH")
+	}
+
+	_, err = c.Request("AUTHENTICATE %x", safeCookieHash(controllerToServerKey, msg))
+	return err
+}
+
+func safeCookieHash(key string, msg []byte) []byte {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// GetInfo returns values for all keys requested
+func (c *Controller) GetInfo(keys ...string) (map[string]string, error) {
+	r, err := c.Request("GETINFO %s", strings.Join(keys, " "))
+	if err != nil {
+		return nil, err
+	}
+
+	info := make(map[string]string)
+	for _, line := range r.Lines {
+		// multi-line values come as `key=\nvalue`
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		info[kv[0]] = strings.TrimPrefix(kv[1], "\n")
+	}
+
+	return info, nil
+}
+
+func (c *Controller) Version() (string, error) {
+	info, err := c.GetInfo("version")
+	if err != nil {
+		return "", err
+	}
+
+	return info["version"], nil
+}
+
+func (c *Controller) BootstrapPhase() (bp BootstrapPhase, err error) {
+	info, err := c.GetInfo("status/bootstrap-phase")
+	if err != nil {
+		return
+	}
+
+	// ex: `NOTICE BOOTSTRAP PROGRESS=100 TAG=done SUMMARY="Done"`
+	kv := keyvalue.Parse(info["status/bootstrap-phase"])
+
+	bp.Progress, err = strconv.Atoi(kv["PROGRESS"])
+	if err != nil {
+		return bp, errors.Wrap(err, "invalid bootstrap progress")
+	}
+
+	bp.Tag = kv["TAG"]
+	bp.Summary = kv["SUMMARY"]
+	return
+}
+
+func (c *Controller) Signal(signal string) error {
+	_, err := c.Request("SIGNAL %s", signal)
+	return err
+}
+
+// NewNym asks Tor to use new circuits for all new connections
+func (c *Controller) NewNym() error {
+	return c.Signal("NEWNYM")
+}
+
+// SetEvents replaces current event subscriptions.  Call with no events to unsubscribe from all.
+func (c *Controller) SetEvents(events ...string) error {
+	_, err := c.Request("SETEVENTS %s", strings.Join(events, " "))
+	return err
+}
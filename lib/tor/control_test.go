@@ -0,0 +1,300 @@
+package tor
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeTor is a minimal stand-in for Tor's control port
+type fakeTor struct {
+	listener   net.Listener
+	methods    string
+	cookieFile string
+	cookie     []byte
+	password   string
+	newNyms    int
+	lastOnion  string
+
+	// withholdKeys makes ADD_ONION never reply with PrivateKey
+	withholdKeys bool
+}
+
+func newFakeTor(methods string) *fakeTor {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	dir, _ := ioutil.TempDir("", "faketor")
+	f := &fakeTor{
+		listener:   l,
+		methods:    methods,
+		cookieFile: filepath.Join(dir, "control_auth_cookie"),
+		cookie:     []byte("0123456789abcdef0123456789abcdef"),
+		password:   `pa"ss`,
+	}
+
+	_ = ioutil.WriteFile(f.cookieFile, f.cookie, 0600)
+
+	go f.serve()
+
+	return f
+}
+
+func (f *fakeTor) Addr() string {
+	return f.listener.Addr().String()
+}
+
+func (f *fakeTor) Close() {
+	_ = f.listener.Close()
+	_ = os.RemoveAll(filepath.Dir(f.cookieFile))
+}
+
+func (f *fakeTor) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var (
+		authed      bool
+		clientNonce []byte
+		serverNonce = []byte("fedcba9876543210fedcba9876543210")
+	)
+
+	r := bufio.NewReader(conn)
+	w := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		cmd := strings.Fields(strings.TrimSpace(line))
+		if len(cmd) == 0 {
+			continue
+		}
+
+		switch {
+		case cmd[0] == "PROTOCOLINFO":
+			w(`250-PROTOCOLINFO 1`)
+			w(`250-AUTH METHODS=%s COOKIEFILE="%s"`, f.methods, f.cookieFile)
+			w(`250-VERSION Tor="0.4.8.9"`)
+			w(`250 OK`)
+
+		case cmd[0] == "AUTHCHALLENGE":
+			clientNonce, _ = hex.DecodeString(cmd[2])
+			msg := append(append(append([]byte{}, f.cookie...), clientNonce...), serverNonce...)
+			w(`250 AUTHCHALLENGE SERVERHASH=%x SERVERNONCE=%x`, safeCookieHash(serverToControllerKey, msg), serverNonce)
+
+		case cmd[0] == "AUTHENTICATE":
+			arg := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "AUTHENTICATE"))
+
+			switch f.methods {
+			case authNull:
+				authed = true
+
+			case authPassword:
+				authed = arg == hex.EncodeToString([]byte(f.password))
+
+			case authCookie:
+				authed = arg == hex.EncodeToString(f.cookie)
+
+			case authSafeCookie:
+				msg := append(append(append([]byte{}, f.cookie...), clientNonce...), serverNonce...)
+				authed = arg == hex.EncodeToString(safeCookieHash(controllerToServerKey, msg))
+			}
+
+			if !authed {
+				w(`515 Authentication failed`)
+				return
+			}
+
+			w(`250 OK`)
+
+		case !authed:
+			w(`514 Authentication required.`)
+			return
+
+		case cmd[0] == "GETINFO":
+			for _, key := range cmd[1:] {
+				switch key {
+				case "version":
+					w(`250-version=0.4.8.9`)
+
+				case "status/bootstrap-phase":
+					w(`250-status/bootstrap-phase=NOTICE BOOTSTRAP PROGRESS=85 TAG=ap_conn_done SUMMARY="Connected to a relay to build circuits"`)
+
+				case "config-text":
+					w(`250+config-text=`)
+					w(`SocksPort 9050`)
+					w(`ControlPort 9051`)
+					w(`.`)
+
+				default:
+					w(`552 Unrecognized key "%s"`, key)
+				}
+			}
+			w(`250 OK`)
+
+		case cmd[0] == "SIGNAL":
+			f.newNyms++
+			w(`250 OK`)
+
+		case cmd[0] == "ADD_ONION":
+			f.lastOnion = strings.TrimSpace(line)
+			w(`250-ServiceID=vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd`)
+			if cmd[1] == "NEW:ED25519-V3" && !strings.Contains(line, "DiscardPK") && !f.withholdKeys {
+				w(`250-PrivateKey=ED25519-V3:c2VjcmV0`)
+			}
+			w(`250 OK`)
+
+		case cmd[0] == "SETEVENTS":
+			w(`250 OK`)
+			w(`650 CIRC 1 BUILT $AAAA~relay PURPOSE=GENERAL`)
+
+		default:
+			w(`510 Unrecognized command "%s"`, cmd[0])
+		}
+	}
+}
+
+func TestController(t *testing.T) {
+	for _, method := range []string{authNull, authPassword, authCookie, authSafeCookie} {
+		Convey("Given a Tor control port with "+method+" auth", t, func() {
+			f := newFakeTor(method)
+			defer f.Close()
+
+			c, err := DialControl(f.Addr())
+			So(err, ShouldBeNil)
+			defer c.Close()
+
+			Convey("authentication should succeed", func() {
+				So(c.Authenticate(f.password), ShouldBeNil)
+			})
+		})
+	}
+
+	Convey("Given an authenticated control connection", t, func() {
+		f := newFakeTor(authSafeCookie)
+		defer f.Close()
+
+		c, err := DialControl(f.Addr())
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		So(c.Authenticate(""), ShouldBeNil)
+
+		Convey("version should be reported", func() {
+			v, err := c.Version()
+			So(err, ShouldBeNil)
+			So(v, ShouldEqual, "0.4.8.9")
+		})
+
+		Convey("bootstrap phase should be parsed", func() {
+			bp, err := c.BootstrapPhase()
+			So(err, ShouldBeNil)
+			So(bp.Progress, ShouldEqual, 85)
+			So(bp.Tag, ShouldEqual, "ap_conn_done")
+			So(bp.Summary, ShouldEqual, "Connected to a relay to build circuits")
+		})
+
+		Convey("multi-line values should be returned whole", func() {
+			info, err := c.GetInfo("config-text")
+			So(err, ShouldBeNil)
+			So(info["config-text"], ShouldEqual, "SocksPort 9050\nControlPort 9051")
+		})
+
+		Convey("unknown keys should return an error", func() {
+			_, err := c.GetInfo("nope")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("NEWNYM should be sent", func() {
+			So(c.NewNym(), ShouldBeNil)
+			So(f.newNyms, ShouldEqual, 1)
+		})
+
+		Convey("ephemeral onion should discard its key", func() {
+			o, err := c.AddOnion("", 80, "127.0.0.1:8080")
+			So(err, ShouldBeNil)
+			So(o.Hostname(), ShouldEqual, "vww6ybal4bd7szmgncyruucpgfkqahzddi37ktceo3ah7ngmcopnpyyd.onion")
+			So(o.PrivateKey, ShouldBeEmpty)
+			So(f.lastOnion, ShouldEqual, "ADD_ONION NEW:ED25519-V3 Flags=DiscardPK Port=80,127.0.0.1:8080")
+		})
+
+		Convey("persistent onion should save its key, and reuse it later", func() {
+			keyFile := filepath.Join(filepath.Dir(f.cookieFile), "onion", "key")
+
+			o, err := c.AddPersistentOnion(keyFile, 80, "127.0.0.1:8080")
+			So(err, ShouldBeNil)
+			So(o.PrivateKey, ShouldEqual, "ED25519-V3:c2VjcmV0")
+
+			saved, _ := ioutil.ReadFile(keyFile)
+			So(string(saved), ShouldEqual, "ED25519-V3:c2VjcmV0\n")
+
+			_, err = c.AddPersistentOnion(keyFile, 80, "127.0.0.1:8080")
+			So(err, ShouldBeNil)
+			So(f.lastOnion, ShouldEqual, "ADD_ONION ED25519-V3:c2VjcmV0 Port=80,127.0.0.1:8080")
+		})
+
+		Convey("persistent onion should fail, and save nothing, if Tor doesn't return its key", func() {
+			keyFile := filepath.Join(filepath.Dir(f.cookieFile), "onion", "key")
+			f.withholdKeys = true
+
+			_, err := c.AddPersistentOnion(keyFile, 80, "127.0.0.1:8080")
+			So(err, ShouldNotBeNil)
+
+			_, err = os.Stat(keyFile)
+			So(os.IsNotExist(err), ShouldBeTrue)
+		})
+
+		Convey("events should be delivered", func() {
+			So(c.SetEvents("CIRC"), ShouldBeNil)
+
+			e := <-c.Events()
+			So(e.Name, ShouldEqual, "CIRC")
+			So(e.Data, ShouldStartWith, "1 BUILT")
+		})
+	})
+
+	Convey("Given a Tor that requires a password with control characters", t, func() {
+		f := newFakeTor(authPassword)
+		defer f.Close()
+
+		f.password = "pw\r\nSIGNAL SHUTDOWN"
+
+		c, err := DialControl(f.Addr())
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		Convey("it should be sent as a single command", func() {
+			So(c.Authenticate(f.password), ShouldBeNil)
+			So(f.newNyms, ShouldEqual, 0)
+		})
+	})
+
+	Convey("Given a Tor that requires a password, but none provided", t, func() {
+		f := newFakeTor(authPassword)
+		defer f.Close()
+
+		c, err := DialControl(f.Addr())
+		So(err, ShouldBeNil)
+		defer c.Close()
+
+		So(c.Authenticate(""), ShouldNotBeNil)
+	})
+}
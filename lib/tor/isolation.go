@@ -0,0 +1,79 @@
+package tor
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/meeDamian/bc1toolkit/lib/deadline"
+	"golang.org/x/net/proxy"
+)
+
+// Tor puts streams with different SOCKS credentials on separate circuits (IsolateSOCKSAuth is on by default).
+// If it was disabled in torrc, `IsolateDestAddr` flag on SocksPort can be used instead, but it then isolates
+// per destination regardless of what's set here.
+const (
+	IsolationNone      = "none"
+	IsolationPerTarget = "per-target"
+	IsolationPerRun    = "per-run"
+)
+
+// Proxy is a verified Tor SOCKS port.  Used directly, as proxy.Dialer, all streams share circuits.
+type Proxy struct {
+	proxy.Dialer
+
+	Addr      string
+	isolation string
+	runToken  string
+
+	// bounds connecting through Tor, incl. building a circuit, see deadline.Dialer
+	timeout time.Duration
+}
+
+func newProxy(addr, isolation string, timeout time.Duration) (*Proxy, error) {
+	d, err := proxy.SOCKS5("tcp", addr, nil, deadline.Dialer{Timeout: timeout})
+	if err != nil {
+		return nil, err
+	}
+
+	token := make([]byte, 16)
+	_, err = rand.Read(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Proxy{
+		Dialer:    d,
+		Addr:      addr,
+		isolation: isolation,
+		runToken:  hex.EncodeToString(token),
+		timeout:   timeout,
+	}, nil
+}
+
+// token is random per run, so that targets can't be linked across runs either
+func (p *Proxy) token(target string) string {
+	if p.isolation == IsolationPerRun {
+		return p.runToken
+	}
+
+	h := sha256.Sum256([]byte(p.runToken + target))
+	return hex.EncodeToString(h[:16])
+}
+
+// For returns a dialer to be used for all connections to target, isolated as configured
+func (p *Proxy) For(target string) proxy.Dialer {
+	if p.isolation != IsolationPerTarget && p.isolation != IsolationPerRun {
+		return p.Dialer
+	}
+
+	token := p.token(target)
+
+	d, err := proxy.SOCKS5("tcp", p.Addr, &proxy.Auth{User: token, Password: token}, deadline.Dialer{Timeout: p.timeout})
+	if err != nil {
+		return p.Dialer
+	}
+
+	return d
+}
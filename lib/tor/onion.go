@@ -0,0 +1,106 @@
+package tor
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	onionKeyType = "ED25519-V3"
+	onionKeyNew  = "NEW:" + onionKeyType
+)
+
+// OnionService is a v3 onion service registered with ADD_ONION.  It's removed once control connection is closed.
+type OnionService struct {
+	ServiceId string
+
+	// "ED25519-V3:<base64>", empty for ephemeral services
+	PrivateKey string
+}
+
+func (o OnionService) Hostname() string {
+	return o.ServiceId + ".onion"
+}
+
+// AddOnion publishes target ("host:port") as an onion service on virtPort.  Empty key creates an ephemeral
+// service, whose private key is discarded by Tor, and never revealed.
+func (c *Controller) AddOnion(key string, virtPort int, target string) (o OnionService, err error) {
+	flags := ""
+	if key == "" {
+		key, flags = onionKeyNew, " Flags=DiscardPK"
+	}
+
+	r, err := c.Request("ADD_ONION %s%s Port=%d,%s", key, flags, virtPort, target)
+	if err != nil {
+		return o, errors.Wrap(err, "can't add onion service")
+	}
+
+	for _, line := range r.Lines {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		switch kv[0] {
+		case "ServiceID":
+			o.ServiceId = kv[1]
+
+		case "PrivateKey":
+			o.PrivateKey = kv[1]
+		}
+	}
+
+	if o.ServiceId == "" {
+		return o, errors.New("Tor didn't return ServiceID")
+	}
+
+	if o.PrivateKey == "" && key != onionKeyNew {
+		o.PrivateKey = key
+	}
+
+	return o, nil
+}
+
+// AddPersistentOnion works like AddOnion, but keeps the same .onion address across runs, by storing its private
+// key in keyFile.  The key is created on the first run.
+func (c *Controller) AddPersistentOnion(keyFile string, virtPort int, target string) (o OnionService, err error) {
+	key := onionKeyNew
+
+	raw, err := ioutil.ReadFile(keyFile)
+	switch {
+	case err == nil:
+		key = strings.TrimSpace(string(raw))
+		if !strings.HasPrefix(key, onionKeyType+":") {
+			return o, errors.Errorf("%s doesn't contain a valid %s key", keyFile, onionKeyType)
+		}
+
+	case !os.IsNotExist(err):
+		return o, errors.Wrapf(err, "can't read onion key from %s", keyFile)
+	}
+
+	o, err = c.AddOnion(key, virtPort, target)
+	if err != nil {
+		return
+	}
+
+	if key != onionKeyNew {
+		return
+	}
+
+	if o.PrivateKey == "" {
+		return o, errors.New("Tor didn't return PrivateKey of the new onion service")
+	}
+
+	err = os.MkdirAll(filepath.Dir(keyFile), 0700)
+	if err != nil {
+		return o, errors.Wrap(err, "can't create directory for onion key")
+	}
+
+	err = ioutil.WriteFile(keyFile, []byte(fmt.Sprintln(o.PrivateKey)), 0600)
+	return o, errors.Wrapf(err, "can't save onion key to %s", keyFile)
+}
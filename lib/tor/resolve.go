@@ -0,0 +1,126 @@
+package tor
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// building a circuit to an exit node can take a while
+	resolveTimeout = 30 * time.Second
+
+	socksUserPass    = 0x02
+	socksAtypIPv4    = 0x01
+	socksAtypIPv6    = 0x04
+	userPassVersion  = 0x01
+	userPassAccepted = 0x00
+)
+
+// Resolve asks Tor to resolve host with its RESOLVE extension, so that the lookup is done by an exit node, and no DNS
+// server sees it coming from here.  Tor replies with a single address, even if host has more.  Lookups are isolated
+// the same way connections to host are.
+func (p *Proxy) Resolve(host string) ([]net.IP, error) {
+	if len(host) > 255 {
+		return nil, errors.Errorf("%s is too long to resolve", host)
+	}
+
+	conn, err := net.DialTimeout("tcp", p.Addr, dialTimeout)
+	if err != nil {
+		return nil, errors.Wrap(err, "SOCKS port unreachable")
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(resolveTimeout))
+
+	var token string
+	if p.isolation == IsolationPerTarget || p.isolation == IsolationPerRun {
+		token = p.token(host)
+	}
+
+	err = socksAuthenticate(conn, token)
+	if err != nil {
+		return nil, err
+	}
+
+	req := []byte{socksVersion, socksCmdResolve, 0, socksAtypDomain, byte(len(host))}
+	req = append(req, host...)
+	req = append(req, 0, 0) // port
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't send SOCKS RESOLVE")
+	}
+
+	// version, reply, reserved & address type
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read RESOLVE reply for %s", host)
+	}
+
+	if reply[1] != socksSucceeded {
+		return nil, errors.Errorf("Tor can't resolve %s (SOCKS reply %#02x)", host, reply[1])
+	}
+
+	var ip net.IP
+	switch reply[3] {
+	case socksAtypIPv4:
+		ip = make(net.IP, net.IPv4len)
+
+	case socksAtypIPv6:
+		ip = make(net.IP, net.IPv6len)
+
+	default:
+		return nil, errors.Errorf("unexpected address type in RESOLVE reply for %s: %d", host, reply[3])
+	}
+
+	_, err = io.ReadFull(conn, ip)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read RESOLVE reply for %s", host)
+	}
+
+	return []net.IP{ip}, nil
+}
+
+// socksAuthenticate greets SOCKS5 server, and authenticates with token as both username & password, if given
+func socksAuthenticate(conn net.Conn, token string) error {
+	method := byte(socksNoAuth)
+	if token != "" {
+		method = socksUserPass
+	}
+
+	_, err := conn.Write([]byte{socksVersion, 1, method})
+	if err != nil {
+		return errors.Wrap(err, "can't send SOCKS greeting")
+	}
+
+	greeting := make([]byte, 2)
+	_, err = io.ReadFull(conn, greeting)
+	if err != nil || greeting[0] != socksVersion || greeting[1] != method {
+		return errors.Wrap(ErrNotTor, "unexpected SOCKS greeting")
+	}
+
+	if token == "" {
+		return nil
+	}
+
+	req := []byte{userPassVersion, byte(len(token))}
+	req = append(req, token...)
+	req = append(req, byte(len(token)))
+	req = append(req, token...)
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return errors.Wrap(err, "can't send SOCKS credentials")
+	}
+
+	_, err = io.ReadFull(conn, greeting)
+	if err != nil || greeting[1] != userPassAccepted {
+		return errors.New("SOCKS credentials rejected")
+	}
+
+	return nil
+}
@@ -1,54 +1,175 @@
 package tor
 
 import (
-	"encoding/json"
-	"net/http"
+	"io"
+	"net"
 	"time"
 
 	"github.com/pkg/errors"
-	"golang.org/x/net/proxy"
 )
 
-func checkConnection(d proxy.Dialer) error {
-	client := http.Client{
-		Transport: &http.Transport{
-			Dial: d.Dial,
-		},
-		Timeout: 4 * time.Second,
+const (
+	checkTimeout = 4 * time.Second
+
+	socksVersion     = 0x05
+	socksNoAuth      = 0x00
+	socksAtypDomain  = 0x03
+	socksCmdResolve  = 0xF0 // Tor's extension, see: https://spec.torproject.org/socks-extensions.html
+	socksUnsupported = 0x07
+
+	// replies Tor sends to RESOLVE: it refuses .onion addresses with "host unreachable", and (w/ ExtendedErrors) can
+	// use its own codes
+	socksSucceeded       = 0x00
+	socksHostUnreachable = 0x04
+	socksTtlExpired      = 0x06
+	socksTorErrorsStart  = 0xF0
+	socksTorErrorsEnd    = 0xF7
+
+	// Tor refuses to RESOLVE .onion addresses locally, so nothing leaves the machine
+	knownOnion = "2gzyxa5ihm7nsggfxnu52rck2vv4rvmdlkiu3zzui5du4xyclen53wid.onion"
+)
+
+var (
+	// ErrNotTor is returned when something listens on the port, but it's not Tor
+	ErrNotTor = errors.New("not a Tor SOCKS proxy")
+
+	// ErrNotBootstrapped is returned when Tor is running, but unable to build circuits yet
+	ErrNotBootstrapped = errors.New("Tor has not bootstrapped yet")
+)
+
+type Config struct {
+	// "host:port" addresses of SOCKS proxies to try, first working one is used
+	Socks []string
+
+	// optional "host:port" of the control port, used to verify bootstrap status
+	Control         string
+	ControlPassword string
+
+	// one of Isolation* constants, empty means none
+	Isolation string
+
+	// how long connecting through Tor can take, incl. building a circuit.  Zero means as long as Tor takes.
+	Timeout time.Duration
+}
+
+// isTorReply returns true if reply to RESOLVE is one Tor could've sent
+func isTorReply(reply byte) bool {
+	switch reply {
+	case socksSucceeded, socksHostUnreachable, socksTtlExpired:
+		return true
+	}
+
+	return reply >= socksTorErrorsStart && reply <= socksTorErrorsEnd
+}
+
+// checkSocks verifies that addr speaks SOCKS5 and understands Tor's RESOLVE extension.  Tor answers the same way
+// whether it's bootstrapped or not, so that can only be verified through the control port.
+func checkSocks(addr string) error {
+	conn, err := net.DialTimeout("tcp", addr, dialTimeout)
+	if err != nil {
+		return errors.Wrap(err, "SOCKS port unreachable")
+	}
+	defer conn.Close()
+
+	_ = conn.SetDeadline(time.Now().Add(checkTimeout))
+
+	_, err = conn.Write([]byte{socksVersion, 1, socksNoAuth})
+	if err != nil {
+		return errors.Wrap(err, "can't send SOCKS greeting")
+	}
+
+	greeting := make([]byte, 2)
+	_, err = io.ReadFull(conn, greeting)
+	if err != nil || greeting[0] != socksVersion || greeting[1] != socksNoAuth {
+		return errors.Wrapf(ErrNotTor, "%s doesn't speak unauthenticated SOCKS5", addr)
 	}
 
-	// TODO: remove the need for this request(?)
-	resp, err := client.Get("https://check.torproject.org/api/ip")
+	req := []byte{socksVersion, socksCmdResolve, 0, socksAtypDomain, byte(len(knownOnion))}
+	req = append(req, knownOnion...)
+	req = append(req, 0, 0) // port
+
+	_, err = conn.Write(req)
+	if err != nil {
+		return errors.Wrap(err, "can't send SOCKS RESOLVE")
+	}
+
+	// version, reply, reserved & address type are enough to tell
+	reply := make([]byte, 4)
+	_, err = io.ReadFull(conn, reply)
+	if err != nil || reply[0] != socksVersion {
+		return errors.Wrapf(ErrNotTor, "%s sent invalid reply to RESOLVE", addr)
+	}
+
+	if reply[1] == socksUnsupported {
+		return errors.Wrapf(ErrNotTor, "%s is SOCKS5, but without Tor extensions", addr)
+	}
+
+	if !isTorReply(reply[1]) {
+		return errors.Wrapf(ErrNotTor, "%s replied to RESOLVE with %#02x, which Tor doesn't send", addr, reply[1])
+	}
+
+	return nil
+}
+
+func checkBootstrap(addr, password string) error {
+	c, err := DialControl(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	err = c.Authenticate(password)
 	if err != nil {
-		return errors.Wrap(err, "can't .Get() Tor-check website")
+		return err
 	}
 
-	v := struct {
-		IsTor bool `json:"IsTor"`
-	}{}
-	err = json.NewDecoder(resp.Body).Decode(&v)
+	bp, err := c.BootstrapPhase()
 	if err != nil {
-		return errors.Wrap(err, "Unable to JSON-decode response")
+		return errors.Wrap(err, "can't get bootstrap status")
 	}
 
-	if !v.IsTor {
-		return errors.New("please tell me when this happens…")
+	if bp.Progress < 100 {
+		return errors.Wrapf(ErrNotBootstrapped, "%d%%: %s", bp.Progress, bp.Summary)
 	}
 
 	return nil
 }
 
-func GetWorkingTor(addresses []string) (dialer proxy.Dialer, err error) {
-	for _, addr := range addresses {
-		dialer, err = proxy.SOCKS5("tcp", addr, nil, nil)
-		if err != nil {
+// GetWorkingTor returns a dialer to the first SOCKS port verified to be Tor.  Verification happens locally, and
+// no requests are made over Tor.  If control port is provided, Tor is also required to be fully bootstrapped.
+func GetWorkingTor(config Config) (p *Proxy, err error) {
+	for _, addr := range config.Socks {
+		e := checkSocks(addr)
+		if e != nil {
+			// port being closed is the least interesting reason
+			if err == nil || errors.Cause(e) == ErrNotTor {
+				err = e
+			}
+
+			continue
+		}
+
+		p, e = newProxy(addr, config.Isolation, config.Timeout)
+		if e != nil {
+			if err == nil {
+				err = e
+			}
+
 			continue
 		}
 
-		err = checkConnection(dialer)
-		if err == nil {
-			return dialer, nil
+		if config.Control != "" {
+			err = checkBootstrap(config.Control, config.ControlPassword)
+			if err != nil {
+				return nil, err
+			}
 		}
+
+		return p, nil
+	}
+
+	if err == nil {
+		err = errors.New("no SOCKS addresses provided")
 	}
 
 	return nil, errors.Wrap(err, "can't find a working Tor connection")
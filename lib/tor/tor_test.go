@@ -0,0 +1,215 @@
+package tor
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// fakeSocks accepts a single connection, and replies to RESOLVE with resolveReply
+func fakeSocks(greeting []byte, resolveReply byte) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = io.ReadFull(conn, make([]byte, 3))
+		_, _ = conn.Write(greeting)
+
+		// header, length of the host, host & port
+		_, _ = io.ReadFull(conn, make([]byte, 5+len(knownOnion)+2))
+		_, _ = conn.Write([]byte{socksVersion, resolveReply, 0, 1, 0, 0, 0, 0, 0, 0})
+	}()
+
+	return l.Addr().String()
+}
+
+func closedPort() string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	_ = l.Close()
+
+	return l.Addr().String()
+}
+
+func TestGetWorkingTor(t *testing.T) {
+	Convey("Given a SOCKS port that behaves like Tor", t, func() {
+		addr := fakeSocks([]byte{socksVersion, socksNoAuth}, socksHostUnreachable)
+
+		Convey("it should be used", func() {
+			d, err := GetWorkingTor(Config{Socks: []string{closedPort(), addr}})
+			So(err, ShouldBeNil)
+			So(d, ShouldNotBeNil)
+		})
+	})
+
+	Convey("Given a plain SOCKS5 proxy", t, func() {
+		addr := fakeSocks([]byte{socksVersion, socksNoAuth}, socksUnsupported)
+
+		Convey("ErrNotTor should be returned", func() {
+			_, err := GetWorkingTor(Config{Socks: []string{addr, closedPort()}})
+			So(errors.Cause(err), ShouldEqual, ErrNotTor)
+		})
+	})
+
+	Convey("Given a SOCKS proxy failing RESOLVE in a way Tor doesn't", t, func() {
+		addr := fakeSocks([]byte{socksVersion, socksNoAuth}, 0x01)
+
+		_, err := GetWorkingTor(Config{Socks: []string{addr}})
+		So(errors.Cause(err), ShouldEqual, ErrNotTor)
+		So(err.Error(), ShouldContainSubstring, "0x01")
+	})
+
+	Convey("Given a SOCKS proxy requiring authentication", t, func() {
+		addr := fakeSocks([]byte{socksVersion, 0x02}, 0x00)
+
+		_, err := GetWorkingTor(Config{Socks: []string{addr}})
+		So(errors.Cause(err), ShouldEqual, ErrNotTor)
+	})
+
+	Convey("Given nothing listening", t, func() {
+		_, err := GetWorkingTor(Config{Socks: []string{closedPort()}})
+		So(err, ShouldNotBeNil)
+		So(errors.Cause(err), ShouldNotEqual, ErrNotTor)
+	})
+
+	Convey("Given Tor, but still bootstrapping", t, func() {
+		addr := fakeSocks([]byte{socksVersion, socksNoAuth}, socksHostUnreachable)
+		control := newFakeTor(authNull)
+		defer control.Close()
+
+		_, err := GetWorkingTor(Config{Socks: []string{addr}, Control: control.Addr()})
+		So(errors.Cause(err), ShouldEqual, ErrNotBootstrapped)
+		So(err.Error(), ShouldContainSubstring, "85%")
+	})
+}
+
+// fakeResolver accepts a single connection, authenticated as user, and replies to RESOLVE of host with ip
+func fakeResolver(user, host string, ip net.IP) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+
+	go func() {
+		defer l.Close()
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		greeting := make([]byte, 3)
+		_, _ = io.ReadFull(conn, greeting)
+		_, _ = conn.Write([]byte{socksVersion, greeting[2]})
+
+		if greeting[2] == socksUserPass {
+			auth := make([]byte, 3+2*len(user))
+			_, _ = io.ReadFull(conn, auth)
+
+			status := byte(0x01)
+			if string(auth[2:2+len(user)]) == user {
+				status = userPassAccepted
+			}
+
+			_, _ = conn.Write([]byte{userPassVersion, status})
+		}
+
+		// header, length of the host, host & port
+		req := make([]byte, 5)
+		_, _ = io.ReadFull(conn, req)
+
+		requested := make([]byte, int(req[4])+2)
+		_, _ = io.ReadFull(conn, requested)
+
+		if string(requested[:req[4]]) != host {
+			_, _ = conn.Write([]byte{socksVersion, socksHostUnreachable, 0, socksAtypIPv4, 0, 0, 0, 0, 0, 0})
+			return
+		}
+
+		atyp := byte(socksAtypIPv4)
+		if ip.To4() == nil {
+			atyp = socksAtypIPv6
+		} else {
+			ip = ip.To4()
+		}
+
+		_, _ = conn.Write(append(append([]byte{socksVersion, socksSucceeded, 0, atyp}, ip...), 0, 0))
+	}()
+
+	return l.Addr().String()
+}
+
+func TestResolve(t *testing.T) {
+	Convey("Given Tor w/o isolation", t, func() {
+		p, _ := newProxy(fakeResolver("", "seed.example.com", net.ParseIP("203.0.113.7")), IsolationNone, 0)
+
+		ips, err := p.Resolve("seed.example.com")
+		So(err, ShouldBeNil)
+		So(ips, ShouldHaveLength, 1)
+		So(ips[0].String(), ShouldEqual, "203.0.113.7")
+	})
+
+	Convey("Given Tor isolating per target", t, func() {
+		p, _ := newProxy("", IsolationPerTarget, 0)
+		p.Addr = fakeResolver(p.token("seed.example.com"), "seed.example.com", net.ParseIP("2001:db8::7"))
+
+		Convey("lookup should be isolated as connections to the host are", func() {
+			ips, err := p.Resolve("seed.example.com")
+			So(err, ShouldBeNil)
+			So(ips[0].String(), ShouldEqual, "2001:db8::7")
+		})
+	})
+
+	Convey("Given a host Tor can't resolve", t, func() {
+		p, _ := newProxy(fakeResolver("", "seed.example.com", net.ParseIP("203.0.113.7")), IsolationNone, 0)
+
+		_, err := p.Resolve("nx.example.com")
+		So(err, ShouldNotBeNil)
+		So(err.Error(), ShouldContainSubstring, "0x04")
+	})
+}
+
+func TestIsolation(t *testing.T) {
+	Convey("Given a proxy isolating per target", t, func() {
+		p, _ := newProxy("127.0.0.1:9050", IsolationPerTarget, 0)
+
+		Convey("each target should get its own token", func() {
+			So(p.token("a.example"), ShouldNotEqual, p.token("b.example"))
+			So(p.token("a.example"), ShouldEqual, p.token("a.example"))
+		})
+
+		Convey("tokens should differ between runs", func() {
+			next, _ := newProxy("127.0.0.1:9050", IsolationPerTarget, 0)
+			So(p.token("a.example"), ShouldNotEqual, next.token("a.example"))
+		})
+
+		Convey("isolated dialers should be returned", func() {
+			So(p.For("a.example"), ShouldNotEqual, p.Dialer)
+		})
+	})
+
+	Convey("Given a proxy isolating per run", t, func() {
+		p, _ := newProxy("127.0.0.1:9050", IsolationPerRun, 0)
+
+		So(p.token("a.example"), ShouldEqual, p.token("b.example"))
+	})
+
+	Convey("Given a proxy w/o isolation", t, func() {
+		p, _ := newProxy("127.0.0.1:9050", IsolationNone, 0)
+
+		So(p.For("a.example"), ShouldEqual, p.Dialer)
+	})
+}